@@ -0,0 +1,95 @@
+package compression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"strings"
+)
+
+const (
+	None = ""
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+var extensions = map[string]string{
+	Gzip: ".gz",
+	Zstd: ".zst",
+}
+
+type Config struct {
+	Codec string `yaml:"codec"`
+	// Level is codec specific, 1-9 for gzip and 1-22 for zstd. Zero uses the
+	// codec default.
+	Level int `yaml:"level,omitempty"`
+}
+
+// Extension returns the file extension of codec.
+func Extension(codec string) string {
+	return extensions[codec]
+}
+
+// FromName guesses the codec from the extension of an artifact name.
+func FromName(name string) string {
+	for codec, ext := range extensions {
+		if strings.HasSuffix(name, ext) {
+			return codec
+		}
+	}
+	return None
+}
+
+// NewWriter returns a writer compressing to w, closing it flushes the
+// compressed stream but does not close w.
+func NewWriter(w io.Writer, c *Config) (io.WriteCloser, error) {
+	if c == nil {
+		return nopCloser{w}, nil
+	}
+
+	switch c.Codec {
+	case None:
+		return nopCloser{w}, nil
+	case Gzip:
+		level := c.Level
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case Zstd:
+		level := zstd.SpeedDefault
+		if c.Level != 0 {
+			level = zstd.EncoderLevelFromZstd(c.Level)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(level))
+	}
+
+	return nil, fmt.Errorf("unknown compression codec %s", c.Codec)
+}
+
+// NewReader returns a reader decompressing r with codec.
+func NewReader(r io.Reader, codec string) (io.ReadCloser, error) {
+	switch codec {
+	case None:
+		return io.NopCloser(r), nil
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+
+	return nil, fmt.Errorf("unknown compression codec %s", codec)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
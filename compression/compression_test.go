@@ -0,0 +1,60 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	content := strings.Repeat("INSERT INTO users (id) VALUES (1);\n", 1000)
+
+	for _, c := range []*Config{nil, {Codec: Gzip}, {Codec: Gzip, Level: 9}, {Codec: Zstd}, {Codec: Zstd, Level: 19}} {
+		codec := None
+		if c != nil {
+			codec = c.Codec
+		}
+
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, c)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatal(err)
+			return
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+			return
+		}
+		if codec != None && buf.Len() >= len(content)/10 {
+			t.Fatalf("%s did not compress: %d bytes", codec, buf.Len())
+		}
+
+		if FromName("1-app.sql"+Extension(codec)) != codec {
+			t.Fatalf("cannot guess %s from its extension", codec)
+		}
+
+		r, err := NewReader(buf, codec)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		_ = r.Close()
+		if string(b) != content {
+			t.Fatalf("%s round trip mismatch", codec)
+		}
+	}
+
+	if _, err := NewWriter(&bytes.Buffer{}, &Config{Codec: "lz4"}); err == nil {
+		t.Fatal("expected error for unknown codec")
+	}
+}
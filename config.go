@@ -5,17 +5,37 @@ import (
 	"gopkg.in/yaml.v2"
 	"os"
 	"path"
+	"react-web-backup/compression"
 	"react-web-backup/database"
+	"react-web-backup/encryption"
+	"react-web-backup/retention"
 	"react-web-backup/storage"
 	"react-web-backup/tunnel"
 )
 
 type Config struct {
-	Action         string                 `yaml:"action"`
-	RestoreVersion string                 `yaml:"restore_version,omitempty"`
-	Storage        *storage.StorageConfig `yaml:"storage,omitempty"`
-	Database       *database.Connection   `yaml:"database,omitempty"`
-	Tunnel         *tunnel.Tunnel         `yaml:"tunnel,omitempty"`
+	Action         string                   `yaml:"action"`
+	RestoreVersion string                   `yaml:"restore_version,omitempty"`
+	Storage        *storage.StorageConfig   `yaml:"storage,omitempty"`
+	Storages       []*storage.StorageConfig `yaml:"storages,omitempty"`
+	StoragePolicy  string                   `yaml:"storage_policy,omitempty"`
+	Database       *database.Connection     `yaml:"database,omitempty"`
+	Tunnel         *tunnel.Tunnel           `yaml:"tunnel,omitempty"`
+	Retention      *retention.Policy        `yaml:"retention,omitempty"`
+	Compression    *compression.Config      `yaml:"compression,omitempty"`
+	Encryption     *encryption.Config       `yaml:"encryption,omitempty"`
+	Copy           *CopyConfig              `yaml:"copy,omitempty"`
+	// SpoolDir keeps each backup on local disk until all its uploads are
+	// done, so that the resume action can finish them without a new dump.
+	SpoolDir string `yaml:"spool_dir,omitempty"`
+}
+
+// CopyConfig selects the backups the copy action transfers, all of them when
+// Backups is empty.
+type CopyConfig struct {
+	Source      *storage.StorageConfig `yaml:"source"`
+	Destination *storage.StorageConfig `yaml:"destination"`
+	Backups     []string               `yaml:"backups,omitempty"`
 }
 
 func getConfig(filePath string) (*Config, error) {
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"react-web-backup/compression"
+	"react-web-backup/database"
+	"react-web-backup/encryption"
+	"react-web-backup/manifest"
+	"react-web-backup/storage"
+	"strings"
+)
+
+// copyBackups transfers the backups of the copy source missing from its
+// destination, each with its manifest once its checksum is verified.
+func copyBackups(c *Config) {
+	if c.Copy == nil || c.Copy.Source == nil || c.Copy.Destination == nil {
+		panic("missing copy source or destination config")
+	}
+
+	src := newStorage(c.Copy.Source, c)
+	dst := newStorage(c.Copy.Destination, c)
+
+	objects, err := src.List("")
+	if err != nil {
+		panic(err)
+	}
+	existing, err := dst.List("")
+	if err != nil {
+		panic(err)
+	}
+
+	present := make(map[string]bool)
+	for _, o := range existing {
+		present[o.Name] = true
+	}
+
+	names := make([]string, 0)
+	available := make(map[string]storage.Object)
+	for _, o := range objects {
+		if !manifest.IsManifest(o.Name) {
+			names = append(names, o.Name)
+			available[o.Name] = o
+		}
+	}
+	if len(c.Copy.Backups) > 0 {
+		for _, name := range c.Copy.Backups {
+			if _, ok := available[name]; !ok {
+				panic(fmt.Sprintf("cannot find backup %s", name))
+			}
+		}
+		names = c.Copy.Backups
+	}
+
+	copied := 0
+	for _, name := range names {
+		if present[name] {
+			if !present[manifest.Name(name)] {
+				if err := copyManifest(src, dst, name); err != nil {
+					panic(err)
+				}
+			}
+			fmt.Printf("Skipping %s, already present\n", name)
+			continue
+		}
+
+		if err := copyBackup(src, dst, available[name], c.Database); err != nil {
+			panic(err)
+		}
+		fmt.Printf("Copied %s\n", name)
+		copied++
+	}
+
+	fmt.Printf("Copied %d backups\n", copied)
+}
+
+// copyBackup copies the backup o with its manifest. The copies are stored at
+// the copy time, retention dates them by the manifest: backups of db without
+// one get a manifest dated by the time o was stored.
+func copyBackup(src storage.Storage, dst storage.Storage, o storage.Object, db *database.Connection) error {
+	name := o.Name
+	m, err := manifest.Read(src, name)
+	if err != nil && !errors.Is(err, storage.ErrNotExist) {
+		return err
+	}
+
+	content, err := src.GetContent(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	digest := manifest.NewDigest()
+	if _, err := dst.Upload(name, io.TeeReader(content, digest)); err != nil {
+		return err
+	}
+
+	if err := verifyCopy(dst, name, m, digest); err != nil {
+		// never leave a copy which looks like a valid backup
+		_ = dst.Delete(name)
+		return err
+	}
+
+	if m == nil {
+		m = backfillManifest(o, digest, db)
+	}
+	if m == nil {
+		fmt.Printf("Warning: %s has no manifest, its copy is dated by the time it was copied\n", name)
+		return nil
+	}
+	return manifest.Write(dst, m)
+}
+
+// backfillManifest describes the backup o taken before manifests existed,
+// nil unless it is a backup of db.
+func backfillManifest(o storage.Object, digest *manifest.Digest, db *database.Connection) *manifest.Manifest {
+	if db == nil || !isBackupFile(o.Name, db.Name) {
+		return nil
+	}
+
+	method := encryption.FromName(o.Name)
+	return &manifest.Manifest{
+		Version:     manifest.Version,
+		Artifact:    o.Name,
+		Client:      db.Client,
+		Database:    db.Name,
+		Schema:      db.Schema,
+		Size:        digest.Size(),
+		SHA256:      digest.Sum(),
+		StartedAt:   o.ModTime,
+		FinishedAt:  o.ModTime,
+		Compression: compression.FromName(strings.TrimSuffix(o.Name, encryption.Extension(method))),
+		Encryption:  method,
+	}
+}
+
+// copyManifest completes a backup copied before its manifest could be.
+func copyManifest(src storage.Storage, dst storage.Storage, name string) error {
+	m, err := manifest.Read(src, name)
+	if errors.Is(err, storage.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return manifest.Write(dst, m)
+}
+
+// verifyCopy reads back the copy of name and checks it against the source
+// content and its manifest.
+func verifyCopy(dst storage.Storage, name string, m *manifest.Manifest, digest *manifest.Digest) error {
+	if m != nil && (m.SHA256 != digest.Sum() || m.Size != digest.Size()) {
+		return fmt.Errorf("%s does not match its manifest", name)
+	}
+
+	content, err := dst.GetContent(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	copied := manifest.NewDigest()
+	if _, err := io.Copy(copied, content); err != nil {
+		return err
+	}
+	if copied.Sum() != digest.Sum() || copied.Size() != digest.Size() {
+		return fmt.Errorf("copy of %s does not match the source", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"react-web-backup/database"
+	"react-web-backup/manifest"
+	"react-web-backup/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCopyConfig(t *testing.T) *Config {
+	return &Config{
+		Database: &database.Connection{Client: "pg", Name: "app"},
+		Copy: &CopyConfig{
+			Source:      &storage.StorageConfig{Client: "file", Options: storage.Options{StoragePath: t.TempDir()}},
+			Destination: &storage.StorageConfig{Client: "file", Options: storage.Options{StoragePath: t.TempDir()}},
+		},
+	}
+}
+
+// panics runs f and returns what it panicked with.
+func panics(f func()) (recovered any) {
+	defer func() {
+		recovered = recover()
+	}()
+	f()
+	return nil
+}
+
+func readContent(t *testing.T, s storage.Storage, name string) string {
+	content, err := s.GetContent(name)
+	if err != nil {
+		t.Fatal(err)
+		return ""
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+	b, err := io.ReadAll(content)
+	if err != nil {
+		t.Fatal(err)
+		return ""
+	}
+	return string(b)
+}
+
+func listNames(t *testing.T, s storage.Storage) []string {
+	objects, err := s.List("")
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	names := make([]string, 0)
+	for _, o := range objects {
+		names = append(names, o.Name)
+	}
+	return names
+}
+
+func TestCopy(t *testing.T) {
+	c := newCopyConfig(t)
+	src := newStorage(c.Copy.Source, c)
+	dst := newStorage(c.Copy.Destination, c)
+
+	startedAt := time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+	first := putBackup(t, src, startedAt, "SELECT 1;")
+	copyBackups(c)
+
+	// the second run only copies the new backup, a file storage would refuse
+	// to upload the first one again
+	second := putBackup(t, src, startedAt.AddDate(0, 0, 1), "SELECT 2;")
+	copyBackups(c)
+
+	names := listNames(t, dst)
+	if len(names) != 4 {
+		t.Fatalf("unexpected copies %v", names)
+	}
+	for content, m := range map[string]*manifest.Manifest{"SELECT 1;": first, "SELECT 2;": second} {
+		if got := readContent(t, dst, m.Artifact); got != content {
+			t.Fatalf("%s holds %q, want %q", m.Artifact, got, content)
+		}
+		copied, err := manifest.Read(dst, m.Artifact)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if !copied.StartedAt.Equal(m.StartedAt) || copied.SHA256 != m.SHA256 {
+			t.Fatalf("unexpected manifest %+v for %s", copied, m.Artifact)
+		}
+	}
+}
+
+func TestCopy_Backups(t *testing.T) {
+	c := newCopyConfig(t)
+	src := newStorage(c.Copy.Source, c)
+	dst := newStorage(c.Copy.Destination, c)
+
+	startedAt := time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+	putBackup(t, src, startedAt, "SELECT 1;")
+	selected := putBackup(t, src, startedAt.AddDate(0, 0, 1), "SELECT 2;")
+
+	c.Copy.Backups = []string{"missing.sql"}
+	if recovered := panics(func() { copyBackups(c) }); recovered == nil {
+		t.Fatal("expected the copy of a missing backup to fail")
+	}
+
+	c.Copy.Backups = []string{selected.Artifact}
+	copyBackups(c)
+	names := listNames(t, dst)
+	if strings.Join(names, ",") != selected.Artifact+","+manifest.Name(selected.Artifact) {
+		t.Fatalf("unexpected copies %v", names)
+	}
+}
+
+func TestCopy_Manifest(t *testing.T) {
+	c := newCopyConfig(t)
+	src := newStorage(c.Copy.Source, c)
+	dst := newStorage(c.Copy.Destination, c)
+
+	// a copy interrupted before its manifest
+	startedAt := time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+	m := putBackup(t, src, startedAt, "SELECT 1;")
+	if _, err := dst.Upload(m.Artifact, strings.NewReader("SELECT 1;")); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	// a backup taken before manifests existed
+	storedAt := time.Date(2020, 1, 2, 3, 4, 0, 0, time.UTC)
+	old := backupFileName("app", storedAt)
+	if _, err := src.Upload(old, strings.NewReader("SELECT 0;")); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if err := os.Chtimes(filepath.Join(c.Copy.Source.Options.StoragePath, old), storedAt, storedAt); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	copyBackups(c)
+
+	copied, err := manifest.Read(dst, m.Artifact)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if !copied.StartedAt.Equal(startedAt) {
+		t.Fatalf("unexpected manifest %+v", copied)
+	}
+
+	backfilled, err := manifest.Read(dst, old)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if !backfilled.StartedAt.Equal(storedAt) || backfilled.Client != "pg" || backfilled.Validate("pg") != nil {
+		t.Fatalf("unexpected manifest %+v", backfilled)
+	}
+	if _, err := manifest.Read(src, old); !errors.Is(err, storage.ErrNotExist) {
+		t.Fatalf("the source got a manifest: %v", err)
+	}
+}
+
+func TestCopy_Mismatch(t *testing.T) {
+	c := newCopyConfig(t)
+	src := newStorage(c.Copy.Source, c)
+	dst := newStorage(c.Copy.Destination, c)
+
+	m := putBackup(t, src, time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC), "SELECT 1;")
+	if err := src.Delete(m.Artifact); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if _, err := src.Upload(m.Artifact, strings.NewReader("SELECT 2;")); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	if recovered := panics(func() { copyBackups(c) }); recovered == nil {
+		t.Fatal("expected the copy of a corrupted backup to fail")
+	}
+	if names := listNames(t, dst); len(names) != 0 {
+		t.Fatalf("the corrupted copy was left behind %v", names)
+	}
+}
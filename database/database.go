@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
+	"io"
 	"strings"
 )
 
@@ -14,13 +15,22 @@ type Connection struct {
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	Schema   string `yaml:"schema,omitempty"`
+	// RefreshMaterializedViews populates the materialized views at the end
+	// of a restore, they are left empty otherwise.
+	RefreshMaterializedViews bool `yaml:"refresh_materialized_views,omitempty"`
+}
+
+// Table summarises a table written by Database.Backup.
+type Table struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
 }
 
 type Database interface {
 	Name() string
 	Connect(ctx context.Context, c *Connection) error
-	Backup(ctx context.Context) (string, error)
-	Restore(ctx context.Context, filePath string) error
+	Backup(ctx context.Context, w io.Writer) ([]Table, error)
+	Restore(ctx context.Context, r io.Reader) error
 }
 
 var registeredDB = make(map[string]Database)
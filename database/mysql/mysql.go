@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	database2 "react-web-backup/database"
+	"react-web-backup/utils"
 	"reflect"
 	"strings"
 
@@ -48,43 +50,59 @@ func (d *DB) Connect(ctx context.Context, c *database2.Connection) error {
 	return nil
 }
 
-func (d *DB) Backup(ctx context.Context) (string, error) {
+func (d *DB) Backup(ctx context.Context, w io.Writer) ([]database2.Table, error) {
 	tables, err := d.getTables(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	sqlString := ""
-
 	// backup create tables
 	for _, t := range tables {
 		s, err := d.getCreateTableQuery(ctx, t)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		if _, err := fmt.Fprintf(w, "%s;\n\n", s); err != nil {
+			return nil, err
 		}
-		sqlString += fmt.Sprintf("%s;\n\n", s)
 	}
 
+	// backup data
+	info := make([]database2.Table, 0)
 	for _, t := range tables {
-		insertSql, err := d.getTableData(ctx, t)
+		rows, err := d.writeTableData(ctx, w, t)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		info = append(info, database2.Table{Name: t, Rows: rows})
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return nil, err
 		}
-		sqlString += fmt.Sprintf("%s\n\n", insertSql)
 	}
 
-	// backup data
-
-	return sqlString, nil
+	return info, nil
 }
 
-func (d *DB) Restore(ctx context.Context, fileContent string) error {
-	_, err := d.conn.ExecContext(ctx, fileContent)
+func (d *DB) Restore(ctx context.Context, r io.Reader) error {
+	tx, err := d.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
 
-	return nil
+	scanner := utils.NewStatementScanner(r)
+	for scanner.Scan() {
+		if _, err := tx.ExecContext(ctx, scanner.Text()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (d *DB) getTables(ctx context.Context) ([]string, error) {
@@ -133,10 +151,10 @@ func (d *DB) getCreateTableQuery(ctx context.Context, name string) (string, erro
 	return sql, rows.Err()
 }
 
-func (d *DB) getTableData(ctx context.Context, name string) (string, error) {
+func (d *DB) writeTableData(ctx context.Context, w io.Writer, name string) (int64, error) {
 	rows, err := d.conn.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s", name))
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 	defer func() {
 		_ = rows.Close()
@@ -144,21 +162,21 @@ func (d *DB) getTableData(ctx context.Context, name string) (string, error) {
 
 	columns, err := rows.Columns()
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 	if len(columns) == 0 {
-		return "", errors.New("No columns in table " + name + ".")
+		return 0, errors.New("No columns in table " + name + ".")
 	}
 
 	columnsType, err := rows.ColumnTypes()
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 	if len(columnsType) == 0 {
-		return "", errors.New("No columns in table " + name + ".")
+		return 0, errors.New("No columns in table " + name + ".")
 	}
 
-	dataText := make([]string, 0)
+	var count int64
 	for rows.Next() {
 		data := make([]interface{}, 0)
 		for _, c := range columnsType {
@@ -175,7 +193,7 @@ func (d *DB) getTableData(ctx context.Context, name string) (string, error) {
 		}
 
 		if err := rows.Scan(data...); err != nil {
-			return "", err
+			return 0, err
 		}
 
 		dataStrings := make([]string, 0)
@@ -215,16 +233,18 @@ func (d *DB) getTableData(ctx context.Context, name string) (string, error) {
 			}
 		}
 
-		dataText = append(
-			dataText,
-			fmt.Sprintf(
-				"INSERT INTO %s (%s) VALUES (%s);",
-				name,
-				strings.Join(insertedColumns, ", "),
-				strings.Join(dataStrings, ","),
-			),
+		_, err := fmt.Fprintf(
+			w,
+			"INSERT INTO %s (%s) VALUES (%s);\n",
+			name,
+			strings.Join(insertedColumns, ", "),
+			strings.Join(dataStrings, ","),
 		)
+		if err != nil {
+			return 0, err
+		}
+		count++
 	}
 
-	return strings.Join(dataText, "\n"), rows.Err()
+	return count, rows.Err()
 }
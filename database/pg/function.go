@@ -0,0 +1,309 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+	"strings"
+)
+
+// Function is a function or procedure, Definition is the output of
+// pg_get_functiondef.
+type Function struct {
+	Name       string
+	Definition string
+	// RowType is set when the function uses the row type of a table, it can
+	// only be created after the tables.
+	RowType bool
+}
+
+// Aggregate is an aggregate function, built from pg_aggregate as
+// pg_get_functiondef does not handle them.
+type Aggregate struct {
+	Name         string
+	Arguments    string
+	Kind         string
+	TransFunc    string
+	TransType    string
+	FinalFunc    string
+	FinalExtra   bool
+	FinalModify  string
+	CombineFunc  string
+	SerialFunc   string
+	DeserialFunc string
+	InitCond     sql.NullString
+	TransSpace   int
+	// the M fields describe the moving-aggregate mode, used when MTransFunc
+	// is set
+	MTransFunc    string
+	MInvTransFunc string
+	MTransType    string
+	MFinalFunc    string
+	MFinalExtra   bool
+	MFinalModify  string
+	MInitCond     sql.NullString
+	MTransSpace   int
+	// SortOp is the OPERATOR() of a MIN- or MAX-like aggregate.
+	SortOp   string
+	Parallel string
+}
+
+// Trigger is a user defined trigger, Definition is the output of
+// pg_get_triggerdef.
+type Trigger struct {
+	Name       string
+	Table      string
+	Definition string
+	Disabled   bool
+}
+
+// notExtension filters out the functions created by an extension, they are
+// restored with it.
+const notExtension = "NOT EXISTS (SELECT 1 FROM pg_depend dep WHERE dep.classid = 'pg_proc'::regclass AND dep.objid = p.oid AND dep.deptype = 'e')"
+
+func (d *DB) getFunctions(ctx context.Context) ([]*Function, error) {
+	qb := squirrel.
+		Select(
+			"p.proname",
+			"pg_get_functiondef(p.oid)",
+			"EXISTS (SELECT 1 FROM pg_depend dep JOIN pg_type ty ON ty.oid = dep.refobjid WHERE dep.classid = 'pg_proc'::regclass AND dep.objid = p.oid AND dep.refclassid = 'pg_type'::regclass AND ty.typrelid <> 0)",
+		).
+		From("pg_proc p").
+		PlaceholderFormat(squirrel.Dollar).
+		Join("pg_namespace n ON n.oid = p.pronamespace").
+		Where(squirrel.Eq{"n.nspname": d.schema()}).
+		Where(squirrel.Eq{"p.prokind": []string{"f", "p"}}).
+		Where(notExtension).
+		OrderBy("p.proname", "p.oid")
+
+	query, args, err := qb.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	functions := make([]*Function, 0)
+	for rows.Next() {
+		f := &Function{}
+		if err := rows.Scan(&f.Name, &f.Definition, &f.RowType); err != nil {
+			return nil, err
+		}
+		functions = append(functions, f)
+	}
+
+	return functions, rows.Err()
+}
+
+func (d *DB) getAggregates(ctx context.Context) ([]*Aggregate, error) {
+	qb := squirrel.
+		Select(
+			"p.proname",
+			"pg_get_function_identity_arguments(p.oid)",
+			"a.aggkind",
+			"a.aggtransfn::text",
+			"format_type(a.aggtranstype, NULL)",
+			"COALESCE(NULLIF(a.aggfinalfn::oid, 0)::regproc::text, '')",
+			"a.aggfinalextra",
+			"a.aggfinalmodify",
+			"COALESCE(NULLIF(a.aggcombinefn::oid, 0)::regproc::text, '')",
+			"COALESCE(NULLIF(a.aggserialfn::oid, 0)::regproc::text, '')",
+			"COALESCE(NULLIF(a.aggdeserialfn::oid, 0)::regproc::text, '')",
+			"a.agginitval",
+			"a.aggtransspace",
+			"COALESCE(NULLIF(a.aggmtransfn::oid, 0)::regproc::text, '')",
+			"COALESCE(NULLIF(a.aggminvtransfn::oid, 0)::regproc::text, '')",
+			"COALESCE(format_type(NULLIF(a.aggmtranstype, 0), NULL), '')",
+			"COALESCE(NULLIF(a.aggmfinalfn::oid, 0)::regproc::text, '')",
+			"a.aggmfinalextra",
+			"a.aggmfinalmodify",
+			"a.aggminitval",
+			"a.aggmtransspace",
+			"COALESCE((SELECT 'OPERATOR(' || quote_ident(opn.nspname) || '.' || op.oprname || ')' FROM pg_operator op JOIN pg_namespace opn ON opn.oid = op.oprnamespace WHERE op.oid = a.aggsortop), '')",
+			"p.proparallel",
+		).
+		From("pg_proc p").
+		PlaceholderFormat(squirrel.Dollar).
+		Join("pg_aggregate a ON a.aggfnoid = p.oid").
+		Join("pg_namespace n ON n.oid = p.pronamespace").
+		Where(squirrel.Eq{"n.nspname": d.schema()}).
+		Where(notExtension).
+		OrderBy("p.proname", "p.oid")
+
+	query, args, err := qb.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aggregates := make([]*Aggregate, 0)
+	for rows.Next() {
+		a := &Aggregate{}
+		err := rows.Scan(
+			&a.Name,
+			&a.Arguments,
+			&a.Kind,
+			&a.TransFunc,
+			&a.TransType,
+			&a.FinalFunc,
+			&a.FinalExtra,
+			&a.FinalModify,
+			&a.CombineFunc,
+			&a.SerialFunc,
+			&a.DeserialFunc,
+			&a.InitCond,
+			&a.TransSpace,
+			&a.MTransFunc,
+			&a.MInvTransFunc,
+			&a.MTransType,
+			&a.MFinalFunc,
+			&a.MFinalExtra,
+			&a.MFinalModify,
+			&a.MInitCond,
+			&a.MTransSpace,
+			&a.SortOp,
+			&a.Parallel,
+		)
+		if err != nil {
+			return nil, err
+		}
+		aggregates = append(aggregates, a)
+	}
+
+	return aggregates, rows.Err()
+}
+
+// getTriggers returns the triggers of the tables and views of the schema,
+// except the internal ones of the foreign keys.
+func (d *DB) getTriggers(ctx context.Context) ([]*Trigger, error) {
+	qb := squirrel.
+		Select("t.tgname", "c.relname", "pg_get_triggerdef(t.oid)", "t.tgenabled = 'D'").
+		From("pg_trigger t").
+		PlaceholderFormat(squirrel.Dollar).
+		Join("pg_class c ON c.oid = t.tgrelid").
+		Join("pg_namespace n ON n.oid = c.relnamespace").
+		Where(squirrel.Eq{"n.nspname": d.schema()}).
+		Where("NOT t.tgisinternal").
+		OrderBy("c.relname", "t.tgname")
+
+	query, args, err := qb.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	triggers := make([]*Trigger, 0)
+	for rows.Next() {
+		t := &Trigger{}
+		if err := rows.Scan(&t.Name, &t.Table, &t.Definition, &t.Disabled); err != nil {
+			return nil, err
+		}
+		triggers = append(triggers, t)
+	}
+
+	return triggers, rows.Err()
+}
+
+func buildCreateFunction(f *Function) string {
+	return strings.TrimSpace(f.Definition)
+}
+
+// finalModify holds the FINALFUNC_MODIFY values by their pg_aggregate code.
+var finalModify = map[string]string{
+	"r": "READ_ONLY",
+	"s": "SHAREABLE",
+	"w": "READ_WRITE",
+}
+
+func buildCreateAggregate(a *Aggregate) string {
+	// ordered-set aggregates default to READ_WRITE, the others to READ_ONLY
+	defaultModify := "r"
+	if a.Kind != "n" {
+		defaultModify = "w"
+	}
+
+	options := []string{
+		"SFUNC = " + a.TransFunc,
+		"STYPE = " + a.TransType,
+	}
+	if a.TransSpace > 0 {
+		options = append(options, fmt.Sprintf("SSPACE = %d", a.TransSpace))
+	}
+	if len(a.FinalFunc) > 0 {
+		options = append(options, "FINALFUNC = "+a.FinalFunc)
+		if a.FinalExtra {
+			options = append(options, "FINALFUNC_EXTRA")
+		}
+	}
+	if len(a.FinalModify) > 0 && a.FinalModify != defaultModify {
+		options = append(options, "FINALFUNC_MODIFY = "+finalModify[a.FinalModify])
+	}
+	if len(a.CombineFunc) > 0 {
+		options = append(options, "COMBINEFUNC = "+a.CombineFunc)
+	}
+	if len(a.SerialFunc) > 0 {
+		options = append(options, "SERIALFUNC = "+a.SerialFunc, "DESERIALFUNC = "+a.DeserialFunc)
+	}
+	if a.InitCond.Valid {
+		options = append(options, "INITCOND = "+pq.QuoteLiteral(a.InitCond.String))
+	}
+	if len(a.MTransFunc) > 0 {
+		options = append(options, "MSFUNC = "+a.MTransFunc, "MINVFUNC = "+a.MInvTransFunc, "MSTYPE = "+a.MTransType)
+		if a.MTransSpace > 0 {
+			options = append(options, fmt.Sprintf("MSSPACE = %d", a.MTransSpace))
+		}
+		if len(a.MFinalFunc) > 0 {
+			options = append(options, "MFINALFUNC = "+a.MFinalFunc)
+			if a.MFinalExtra {
+				options = append(options, "MFINALFUNC_EXTRA")
+			}
+		}
+		if len(a.MFinalModify) > 0 && a.MFinalModify != defaultModify {
+			options = append(options, "MFINALFUNC_MODIFY = "+finalModify[a.MFinalModify])
+		}
+		if a.MInitCond.Valid {
+			options = append(options, "MINITCOND = "+pq.QuoteLiteral(a.MInitCond.String))
+		}
+	}
+	if len(a.SortOp) > 0 {
+		options = append(options, "SORTOP = "+a.SortOp)
+	}
+	switch a.Parallel {
+	case "s":
+		options = append(options, "PARALLEL = SAFE")
+	case "r":
+		options = append(options, "PARALLEL = RESTRICTED")
+	}
+	// hypothetical-set aggregates are ordered-set ones
+	if a.Kind == "h" {
+		options = append(options, "HYPOTHETICAL")
+	}
+
+	return fmt.Sprintf("CREATE AGGREGATE %s(%s) (\n    %s\n)", pq.QuoteIdentifier(a.Name), a.Arguments, strings.Join(options, ",\n    "))
+}
+
+// buildCreateTrigger returns the statements creating t, to run once the data
+// is loaded so that the trigger does not fire for restored rows.
+func buildCreateTrigger(t *Trigger) []string {
+	statements := []string{t.Definition}
+	if t.Disabled {
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s DISABLE TRIGGER %s", pq.QuoteIdentifier(t.Table), pq.QuoteIdentifier(t.Name)))
+	}
+	return statements
+}
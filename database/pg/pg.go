@@ -6,35 +6,68 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Masterminds/squirrel"
-	"github.com/umisama/go-sqlbuilder"
-	"github.com/umisama/go-sqlbuilder/dialects"
+	"github.com/lib/pq"
+	"io"
 	database2 "react-web-backup/database"
 	"react-web-backup/utils"
 	"reflect"
+	"strconv"
 	"strings"
-
-	_ "github.com/lib/pq"
 )
 
+const defaultSchema = "public"
+
 func init() {
 	database2.RegisterDb(&DB{})
 }
 
+// ColumnInfo describes a column of a table, the fields are scanned by their
+// json tag from the columns of getSelectColumns, in the same order.
 type ColumnInfo struct {
-	OrdinalPosition   int64  `json:"ordinal_position,omitempty"`
-	ColumnName        string `json:"column_name,omitempty"`
-	DataType          string `json:"data_type,omitempty"`
-	FormatType        string `json:"format_type,omitempty"`
-	NumericPrecision  int    `json:"numeric_precision,omitempty"`
-	DatetimePrecision string `json:"datetime_precision,omitempty"`
-	NumericScale      int    `json:"numeric_scale,omitempty"`
-	DataLength        int    `json:"data_length,omitempty"`
-	IsNullable        string `json:"is_nullable,omitempty"`
-	Check             string `json:"check,omitempty"`
-	CheckConstraint   string `json:"check_constraint,omitempty"`
-	ColumnDefault     string `json:"column_default,omitempty"`
-	ForeignKey        string `json:"foreign_key,omitempty"`
-	Comment           string `json:"comment,omitempty"`
+	OrdinalPosition int64  `json:"ordinal_position,omitempty"`
+	ColumnName      string `json:"column_name,omitempty"`
+	DataType        string `json:"data_type,omitempty"`
+	FormatType      string `json:"format_type,omitempty"`
+	IsNullable      string `json:"is_nullable,omitempty"`
+	ColumnDefault   string `json:"column_default,omitempty"`
+	// Generated is "s" for stored and "v" for virtual generated columns whose
+	// expression is ColumnDefault.
+	Generated string `json:"generated,omitempty"`
+	// Identity is "a" for GENERATED ALWAYS and "d" for GENERATED BY DEFAULT
+	// identity columns.
+	Identity  string `json:"identity,omitempty"`
+	Collation string `json:"collation,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	// Sequence is the sequence of an identity column.
+	Sequence *Sequence `json:"-"`
+}
+
+// Constraint is a table constraint, Definition is the output of
+// pg_get_constraintdef.
+type Constraint struct {
+	Name       string
+	Type       string
+	Definition string
+}
+
+const (
+	ConstraintPrimaryKey = "p"
+	ConstraintUnique     = "u"
+	ConstraintCheck      = "c"
+	ConstraintExclusion  = "x"
+	ConstraintForeignKey = "f"
+)
+
+// Table is a base table read from the catalog.
+type Table struct {
+	OID         int64
+	Name        string
+	Comment     string
+	Columns     []*ColumnInfo
+	Constraints []Constraint
+	// Indexes holds the CREATE INDEX statements of the indexes not backing a
+	// constraint.
+	Indexes []string
 }
 
 type DB struct {
@@ -76,43 +109,184 @@ func (d *DB) Connect(ctx context.Context, c *database2.Connection) error {
 	return d.init()
 }
 
-func (d *DB) Backup(ctx context.Context) (string, error) {
-	tables, err := d.getTables(ctx)
+// Backup writes the sequences, functions, tables and views first, then the
+// table data and finally the sequence values, indexes, foreign keys and
+// triggers, so rows are loaded fast, in any order and without firing triggers.
+func (d *DB) Backup(ctx context.Context, w io.Writer) ([]database2.Table, error) {
+	names, err := d.getTables(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	sqlString := ""
+	// the catalog functions only qualify names outside the search path, and
+	// function bodies may use tables created later
+	header := []string{
+		fmt.Sprintf("SET search_path TO %s", pq.QuoteIdentifier(d.schema())),
+		"SET check_function_bodies = false",
+	}
+	if err := writeStatements(w, header); err != nil {
+		return nil, err
+	}
+
+	sequences, err := d.getSequences(ctx)
+	if err != nil {
+		return nil, err
+	}
+	identities := make(map[string]*Sequence)
+	sequenceValues := make([]string, 0)
+	for _, s := range sequences {
+		if s.Identity {
+			identities[s.OwnerTable+"."+s.OwnerColumn] = s
+		} else if err := writeStatements(w, []string{buildCreateSequence(s)}); err != nil {
+			return nil, err
+		}
+		sequenceValues = append(sequenceValues, buildSequenceValues(s)...)
+	}
+
+	// backup functions, those using the row type of a table follow the tables
+	functions, err := d.getFunctions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rowTypeFunctions := make([]string, 0)
+	for _, f := range functions {
+		if f.RowType {
+			rowTypeFunctions = append(rowTypeFunctions, buildCreateFunction(f))
+		} else if err := writeStatements(w, []string{buildCreateFunction(f)}); err != nil {
+			return nil, err
+		}
+	}
 
 	// backup create tables
-	for _, t := range tables {
-		s, err := d.getCreateTableQuery(ctx, t)
+	tables := make([]*Table, 0)
+	indexes := make([]string, 0)
+	foreignKeys := make([]string, 0)
+	for _, name := range names {
+		t, err := d.getTable(ctx, name)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		for _, c := range t.Columns {
+			c.Sequence = identities[t.Name+"."+c.ColumnName]
+		}
+		if err := writeStatements(w, buildCreateTable(t)); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+		indexes = append(indexes, t.Indexes...)
+		foreignKeys = append(foreignKeys, buildForeignKeys(t)...)
+	}
+
+	if err := writeStatements(w, rowTypeFunctions); err != nil {
+		return nil, err
+	}
+	aggregates, err := d.getAggregates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range aggregates {
+		if err := writeStatements(w, []string{buildCreateAggregate(a)}); err != nil {
+			return nil, err
 		}
-		sqlString += fmt.Sprintf("%s\n\n", s)
 	}
 
+	// backup views
+	views, err := d.getViews(ctx, d.conn)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range views {
+		if err := writeStatements(w, buildCreateView(v)); err != nil {
+			return nil, err
+		}
+		if v.Kind == MaterializedViewKind {
+			if v.Indexes, err = d.getIndexes(ctx, v.OID); err != nil {
+				return nil, err
+			}
+			indexes = append(indexes, v.Indexes...)
+		}
+	}
+
+	// backup data
+	info := make([]database2.Table, 0)
 	for _, t := range tables {
-		insertSql, err := d.getTableData(ctx, t)
+		rows, err := d.writeTableData(ctx, w, t)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		info = append(info, database2.Table{Name: t.Name, Rows: rows})
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return nil, err
 		}
-		sqlString += fmt.Sprintf("%s\n\n", insertSql)
 	}
 
-	// backup data
+	if err := writeStatements(w, sequenceValues); err != nil {
+		return nil, err
+	}
+	// foreign keys may reference the columns of a unique index
+	if err := writeStatements(w, indexes); err != nil {
+		return nil, err
+	}
+	if err := writeStatements(w, foreignKeys); err != nil {
+		return nil, err
+	}
+
+	triggers, err := d.getTriggers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range triggers {
+		if err := writeStatements(w, buildCreateTrigger(t)); err != nil {
+			return nil, err
+		}
+	}
 
-	return sqlString, nil
+	return info, nil
 }
 
-func (d *DB) Restore(ctx context.Context, fileContent string) error {
-	_, err := d.conn.ExecContext(ctx, fileContent)
+func (d *DB) Restore(ctx context.Context, r io.Reader) error {
+	tx, err := d.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
 
-	return nil
+	scanner := utils.NewStatementScanner(r)
+	for scanner.Scan() {
+		if _, err := tx.ExecContext(ctx, scanner.Text()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if d.config.RefreshMaterializedViews {
+		// the views were created in tx, they are only visible from it
+		views, err := d.getViews(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, v := range views {
+			if v.Kind != MaterializedViewKind {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("REFRESH MATERIALIZED VIEW %s", pq.QuoteIdentifier(v.Name))); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (d *DB) schema() string {
+	if len(d.config.Schema) == 0 {
+		return defaultSchema
+	}
+	return d.config.Schema
 }
 
 func (d *DB) getTables(ctx context.Context) ([]string, error) {
@@ -121,7 +295,8 @@ func (d *DB) getTables(ctx context.Context) ([]string, error) {
 		From("information_schema.tables").
 		PlaceholderFormat(squirrel.Dollar).
 		Where(squirrel.Eq{"table_catalog": d.config.Name}).
-		Where(squirrel.Eq{"table_schema": d.config.Schema})
+		Where(squirrel.Eq{"table_schema": d.schema()}).
+		Where(squirrel.Eq{"table_type": "BASE TABLE"})
 
 	query, args, err := qb.ToSql()
 	if err != nil {
@@ -147,39 +322,72 @@ func (d *DB) getTables(ctx context.Context) ([]string, error) {
 	return tables, rows.Err()
 }
 
-func (d *DB) getCreateTableQuery(ctx context.Context, name string) (string, error) {
+// getTable reads the columns, constraints and comments of the table name.
+func (d *DB) getTable(ctx context.Context, name string) (*Table, error) {
+	t := &Table{Name: name}
+
+	var comment sql.NullString
+	err := d.conn.QueryRowContext(
+		ctx,
+		"SELECT c.oid, obj_description(c.oid, 'pg_class') FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = $1 AND c.relname = $2",
+		d.schema(),
+		name,
+	).Scan(&t.OID, &comment)
+	if err != nil {
+		return nil, fmt.Errorf("table %s: %w", name, err)
+	}
+	t.Comment = comment.String
+
+	if t.Columns, err = d.getColumns(ctx, t.OID); err != nil {
+		return nil, err
+	}
+	if t.Constraints, err = d.getConstraints(ctx, t.OID); err != nil {
+		return nil, err
+	}
+	if t.Indexes, err = d.getIndexes(ctx, t.OID); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (d *DB) getColumns(ctx context.Context, oid int64) ([]*ColumnInfo, error) {
 	qb := squirrel.
 		Select(d.getSelectColumns()...).
-		From("information_schema.columns").
+		From("pg_attribute a").
 		PlaceholderFormat(squirrel.Dollar).
-		Where(squirrel.Eq{"table_name": name}).
-		Where(squirrel.Eq{"table_schema": d.config.Schema}).
-		Join("pg_attribute pa ON attrelid=24578 AND attname=column_name")
+		Join("pg_type t ON t.oid = a.atttypid").
+		LeftJoin("pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum").
+		LeftJoin("pg_collation co ON co.oid = a.attcollation AND a.attcollation <> t.typcollation").
+		LeftJoin("pg_namespace con ON con.oid = co.collnamespace").
+		Where(squirrel.Eq{"a.attrelid": oid}).
+		Where("a.attnum > 0 AND NOT a.attisdropped").
+		OrderBy("a.attnum")
 
 	query, args, err := qb.ToSql()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	rows, err := d.conn.QueryContext(ctx, query, args...)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer rows.Close()
 
 	cs, err := rows.Columns()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	columns := make(map[string]*ColumnInfo)
+	columns := make([]*ColumnInfo, 0)
 	for rows.Next() {
 		dest := &ColumnInfo{}
 		ve := reflect.ValueOf(dest).Elem()
 		values := d.values
 		err := rows.Scan(values...)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		for i, c := range cs {
@@ -199,16 +407,112 @@ func (d *DB) getCreateTableQuery(ctx context.Context, name string) (string, erro
 			}
 		}
 
-		columns[dest.ColumnName] = dest
+		columns = append(columns, dest)
+	}
+
+	return columns, rows.Err()
+}
+
+// getConstraints returns the constraints of the table oid, primary key first.
+// NOT NULL constraints are part of the columns.
+func (d *DB) getConstraints(ctx context.Context, oid int64) ([]Constraint, error) {
+	qb := squirrel.
+		Select("conname", "contype", "pg_get_constraintdef(oid, true)").
+		From("pg_constraint").
+		PlaceholderFormat(squirrel.Dollar).
+		Where(squirrel.Eq{"conrelid": oid}).
+		Where(squirrel.Eq{"contype": []string{
+			ConstraintPrimaryKey,
+			ConstraintUnique,
+			ConstraintCheck,
+			ConstraintExclusion,
+			ConstraintForeignKey,
+		}}).
+		OrderBy("array_position(ARRAY['p', 'u', 'c', 'x', 'f'], contype::text)", "conname")
+
+	query, args, err := qb.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	constraints := make([]Constraint, 0)
+	for rows.Next() {
+		var c Constraint
+		if err := rows.Scan(&c.Name, &c.Type, &c.Definition); err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, c)
+	}
+
+	return constraints, rows.Err()
+}
+
+// getIndexes returns the definitions of the valid indexes of the table oid,
+// except those created by primary key, unique and exclusion constraints.
+func (d *DB) getIndexes(ctx context.Context, oid int64) ([]string, error) {
+	qb := squirrel.
+		Select("pg_get_indexdef(i.indexrelid)").
+		From("pg_index i").
+		PlaceholderFormat(squirrel.Dollar).
+		Join("pg_class c ON c.oid = i.indexrelid").
+		Where(squirrel.Eq{"i.indrelid": oid}).
+		Where("i.indisvalid").
+		Where("NOT EXISTS (SELECT 1 FROM pg_constraint co WHERE co.conrelid = i.indrelid AND co.conindid = i.indexrelid AND co.contype IN ('p', 'u', 'x'))").
+		OrderBy("c.relname")
+
+	query, args, err := qb.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := make([]string, 0)
+	for rows.Next() {
+		var index string
+		if err := rows.Scan(&index); err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, index)
 	}
 
-	return d.buildCreateTable(name, columns)
+	return indexes, rows.Err()
 }
 
-func (d *DB) getTableData(ctx context.Context, name string) (string, error) {
-	rows, err := d.conn.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s", name))
+func (d *DB) writeTableData(ctx context.Context, w io.Writer, t *Table) (int64, error) {
+	// generated columns are computed again on insert
+	selected := make([]string, 0)
+	overriding := ""
+	for _, c := range t.Columns {
+		if len(c.Generated) == 0 {
+			selected = append(selected, pq.QuoteIdentifier(c.ColumnName))
+		}
+		if c.Identity == "a" {
+			overriding = " OVERRIDING SYSTEM VALUE"
+		}
+	}
+	if len(selected) == 0 {
+		return 0, nil
+	}
+
+	rows, err := d.conn.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s.%s",
+		strings.Join(selected, ", "),
+		pq.QuoteIdentifier(d.schema()),
+		pq.QuoteIdentifier(t.Name),
+	))
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 	defer func() {
 		_ = rows.Close()
@@ -216,21 +520,21 @@ func (d *DB) getTableData(ctx context.Context, name string) (string, error) {
 
 	columns, err := rows.Columns()
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 	if len(columns) == 0 {
-		return "", errors.New("No columns in table " + name + ".")
+		return 0, errors.New("No columns in table " + t.Name + ".")
 	}
 
 	columnsType, err := rows.ColumnTypes()
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 	if len(columnsType) == 0 {
-		return "", errors.New("No columns in table " + name + ".")
+		return 0, errors.New("No columns in table " + t.Name + ".")
 	}
 
-	dataText := make([]string, 0)
+	var count int64
 	for rows.Next() {
 		data := make([]interface{}, 0)
 		for _, c := range columnsType {
@@ -247,76 +551,64 @@ func (d *DB) getTableData(ctx context.Context, name string) (string, error) {
 		}
 
 		if err := rows.Scan(data...); err != nil {
-			return "", err
+			return 0, err
 		}
 
 		dataStrings := make([]string, 0)
 		insertedColumns := make([]string, 0)
 
-		for i, c := range columnsType {
-			cType := c.ScanType().Kind()
-			switch cType {
-			case reflect.String, reflect.Slice, reflect.Struct, reflect.Map, reflect.Ptr:
-				v := data[i].(*sql.NullString)
-				if v != nil && v.Valid {
-					dataStrings = append(dataStrings, fmt.Sprintf("'%s'", v.String))
-					insertedColumns = append(insertedColumns, columns[i])
-				}
-			case reflect.Bool:
-				v := data[i].(*sql.NullBool)
-				if v != nil && v.Valid {
-					var value = 1
-					if !v.Bool {
-						value = 0
-					}
-					dataStrings = append(dataStrings, fmt.Sprintf("%d", value))
-					insertedColumns = append(insertedColumns, columns[i])
-				}
-			case reflect.Float32, reflect.Float64:
-				v := data[i].(*sql.NullFloat64)
-				if v != nil && v.Valid {
-					dataStrings = append(dataStrings, fmt.Sprintf("%v", v.Float64))
-					insertedColumns = append(insertedColumns, columns[i])
-				}
-			case reflect.Int64, reflect.Int32, reflect.Int, reflect.Uint64, reflect.Uint32, reflect.Uint:
-				v := data[i].(*sql.NullInt64)
-				if v != nil && v.Valid {
-					dataStrings = append(dataStrings, fmt.Sprintf("%d", v.Int64))
-					insertedColumns = append(insertedColumns, columns[i])
-				}
+		for i := range columnsType {
+			if value, ok := literal(data[i]); ok {
+				dataStrings = append(dataStrings, value)
+				insertedColumns = append(insertedColumns, pq.QuoteIdentifier(columns[i]))
 			}
 		}
 
-		dataText = append(
-			dataText,
-			fmt.Sprintf(
-				"INSERT INTO %s (%s) VALUES (%s);",
-				name,
-				strings.Join(insertedColumns, ", "),
-				strings.Join(dataStrings, ","),
-			),
+		_, err := fmt.Fprintf(
+			w,
+			"INSERT INTO %s (%s)%s VALUES (%s);\n",
+			pq.QuoteIdentifier(t.Name),
+			strings.Join(insertedColumns, ", "),
+			overriding,
+			strings.Join(dataStrings, ","),
 		)
+		if err != nil {
+			return 0, err
+		}
+		count++
 	}
 
-	return strings.Join(dataText, "\n"), rows.Err()
+	return count, rows.Err()
+}
+
+// literal returns the SQL literal of a value scanned by writeTableData, false
+// when it is NULL.
+func literal(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case *sql.NullString:
+		return pq.QuoteLiteral(v.String), v.Valid
+	case *sql.NullBool:
+		return strconv.FormatBool(v.Bool), v.Valid
+	case *sql.NullFloat64:
+		return fmt.Sprintf("%v", v.Float64), v.Valid
+	case *sql.NullInt64:
+		return strconv.FormatInt(v.Int64, 10), v.Valid
+	}
+	return "", false
 }
 
 func (d *DB) getSelectColumns() []string {
 	return []string{
-		"information_schema.columns.ordinal_position as ordinal_position",
-		"information_schema.columns.column_name as column_name",
-		"information_schema.columns.udt_name AS data_type",
-		"format_type(atttypid, atttypmod) as format_type",
-		"information_schema.columns.numeric_precision as numeric_precision",
-		"information_schema.columns.datetime_precision as datetime_precision",
-		"information_schema.columns.numeric_scale as numeric_scale",
-		"information_schema.columns.character_maximum_length AS data_length",
-		"information_schema.columns.is_nullable as is_nullable",
-		"information_schema.columns.column_name as check",
-		"information_schema.columns.column_name as check_constraint",
-		"information_schema.columns.column_default as column_default",
-		"information_schema.columns.column_name AS foreign_key",
-		"pg_catalog.col_description(24578,ordinal_position) as comment",
+		"a.attnum AS ordinal_position",
+		"a.attname AS column_name",
+		"t.typname AS data_type",
+		"format_type(a.atttypid, a.atttypmod) AS format_type",
+		"CASE WHEN a.attnotnull THEN 'NO' ELSE 'YES' END AS is_nullable",
+		"pg_get_expr(ad.adbin, ad.adrelid) AS column_default",
+		"NULLIF(a.attgenerated, '') AS generated",
+		"NULLIF(a.attidentity, '') AS identity",
+		"quote_ident(con.nspname) || '.' || quote_ident(co.collname) AS collation",
+		"col_description(a.attrelid, a.attnum) AS comment",
 	}
 }
 
@@ -352,40 +644,83 @@ func (d *DB) init() error {
 	return nil
 }
 
-func (d *DB) buildCreateTable(name string, dest map[string]*ColumnInfo) (string, error) {
-	sqlbuilder.SetDialect(dialects.Postgresql{})
+// buildCreateTable returns the CREATE TABLE statement of t followed by its
+// comments. Foreign keys are left to buildForeignKeys.
+func buildCreateTable(t *Table) []string {
+	definitions := make([]string, 0)
+	for _, c := range t.Columns {
+		definitions = append(definitions, buildColumn(c))
+	}
+	for _, c := range t.Constraints {
+		if c.Type != ConstraintForeignKey {
+			definitions = append(definitions, fmt.Sprintf("CONSTRAINT %s %s", pq.QuoteIdentifier(c.Name), c.Definition))
+		}
+	}
 
-	columns := make([]sqlbuilder.ColumnConfig, 0)
+	name := pq.QuoteIdentifier(t.Name)
+	statements := []string{fmt.Sprintf("CREATE TABLE %s (\n    %s\n)", name, strings.Join(definitions, ",\n    "))}
+	if len(t.Comment) > 0 {
+		statements = append(statements, fmt.Sprintf("COMMENT ON TABLE %s IS %s", name, pq.QuoteLiteral(t.Comment)))
+	}
+	for _, c := range t.Columns {
+		if len(c.Comment) > 0 {
+			statements = append(statements, fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s", name, pq.QuoteIdentifier(c.ColumnName), pq.QuoteLiteral(c.Comment)))
+		}
+	}
+
+	return statements
+}
 
-	for cn, c := range dest {
-		columns = append(columns, d.buildColumn(cn, c))
+func buildColumn(info *ColumnInfo) string {
+	column := pq.QuoteIdentifier(info.ColumnName) + " " + info.FormatType
+	if len(info.Collation) > 0 {
+		column += " COLLATE " + info.Collation
 	}
 
-	table := sqlbuilder.NewTable(
-		name,
-		&sqlbuilder.TableOption{},
-		columns...,
-	)
+	switch {
+	case info.Generated == "s":
+		column += fmt.Sprintf(" GENERATED ALWAYS AS (%s) STORED", info.ColumnDefault)
+	case len(info.Generated) > 0:
+		column += fmt.Sprintf(" GENERATED ALWAYS AS (%s)", info.ColumnDefault)
+	case len(info.Identity) > 0:
+		when := "ALWAYS"
+		if info.Identity == "d" {
+			when = "BY DEFAULT"
+		}
+		column += fmt.Sprintf(" GENERATED %s AS IDENTITY", when)
+		if info.Sequence != nil {
+			column += fmt.Sprintf(" (SEQUENCE NAME %s %s)", pq.QuoteIdentifier(info.Sequence.Name), buildSequenceOptions(info.Sequence))
+		}
+	case len(info.ColumnDefault) > 0:
+		column += " DEFAULT " + info.ColumnDefault
+	}
 
-	query, _, err := sqlbuilder.CreateTable(table).ToSql()
-	if err != nil {
-		return "", err
+	if info.IsNullable == "NO" {
+		column += " NOT NULL"
 	}
 
-	return query, nil
+	return column
 }
 
-func (d *DB) buildColumn(name string, info *ColumnInfo) sqlbuilder.ColumnConfig {
-	o := &sqlbuilder.ColumnOption{
-		NotNull: info.IsNullable == "No",
-		SqlType: info.DataType,
+// buildForeignKeys returns the statements adding the foreign keys of t, to
+// run once every table is loaded.
+func buildForeignKeys(t *Table) []string {
+	statements := make([]string, 0)
+	for _, c := range t.Constraints {
+		if c.Type == ConstraintForeignKey {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", pq.QuoteIdentifier(t.Name), pq.QuoteIdentifier(c.Name), c.Definition))
+		}
 	}
+	return statements
+}
 
-	if len(info.ColumnDefault) > 0 {
-		o.Default = info.ColumnDefault
+func writeStatements(w io.Writer, statements []string) error {
+	for _, s := range statements {
+		if _, err := fmt.Fprintf(w, "%s;\n\n", s); err != nil {
+			return err
+		}
 	}
-
-	return sqlbuilder.AnyColumn(name, o)
+	return nil
 }
 
 func getKeyFromTag(tag string) string {
@@ -1,8 +1,13 @@
 package pg
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
 	"react-web-backup/database"
+	"react-web-backup/utils"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -23,11 +28,237 @@ func TestDB_Backup(t *testing.T) {
 		return
 	}
 
-	s, err := db.Backup(ctx)
+	s := &bytes.Buffer{}
+	_, err = db.Backup(ctx, s)
 	if err != nil {
 		t.Fatal(err)
 		return
 	}
 
-	t.Log(s)
+	t.Log(s.String())
+}
+
+func TestBuildCreateTable(t *testing.T) {
+	table := &Table{
+		Name:    "order",
+		Comment: "customer's orders",
+		Columns: []*ColumnInfo{
+			{ColumnName: "id", FormatType: "integer", IsNullable: "NO", ColumnDefault: "nextval('order_id_seq'::regclass)"},
+			{ColumnName: "customer_id", FormatType: "integer", IsNullable: "YES"},
+			{ColumnName: "code", FormatType: "character varying(16)", IsNullable: "YES", Collation: `pg_catalog."C"`, Comment: "public code"},
+			{ColumnName: "total", FormatType: "numeric(10,2)", IsNullable: "YES", ColumnDefault: "(price * 2)", Generated: "s"},
+		},
+		Constraints: []Constraint{
+			{Name: "order_pkey", Type: ConstraintPrimaryKey, Definition: "PRIMARY KEY (id)"},
+			{Name: "order_code_key", Type: ConstraintUnique, Definition: "UNIQUE (code)"},
+			{Name: "order_customer_id_fkey", Type: ConstraintForeignKey, Definition: "FOREIGN KEY (customer_id) REFERENCES customer(id)"},
+		},
+	}
+
+	expected := []string{
+		"CREATE TABLE \"order\" (\n" +
+			"    \"id\" integer DEFAULT nextval('order_id_seq'::regclass) NOT NULL,\n" +
+			"    \"customer_id\" integer,\n" +
+			"    \"code\" character varying(16) COLLATE pg_catalog.\"C\",\n" +
+			"    \"total\" numeric(10,2) GENERATED ALWAYS AS ((price * 2)) STORED,\n" +
+			"    CONSTRAINT \"order_pkey\" PRIMARY KEY (id),\n" +
+			"    CONSTRAINT \"order_code_key\" UNIQUE (code)\n" +
+			")",
+		`COMMENT ON TABLE "order" IS 'customer''s orders'`,
+		`COMMENT ON COLUMN "order"."code" IS 'public code'`,
+	}
+	if got := buildCreateTable(table); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+		return
+	}
+
+	foreignKeys := buildForeignKeys(table)
+	if len(foreignKeys) != 1 || foreignKeys[0] != `ALTER TABLE "order" ADD CONSTRAINT "order_customer_id_fkey" FOREIGN KEY (customer_id) REFERENCES customer(id)` {
+		t.Fatalf("unexpected foreign keys %q", foreignKeys)
+	}
+}
+
+func TestBuildSequence(t *testing.T) {
+	serial := &Sequence{
+		Name:        "order_id_seq",
+		DataType:    "integer",
+		Start:       1,
+		Min:         1,
+		Max:         2147483647,
+		Increment:   1,
+		Cache:       1,
+		LastValue:   sql.NullInt64{Int64: 42, Valid: true},
+		OwnerTable:  "order",
+		OwnerColumn: "id",
+	}
+	if s := buildCreateSequence(serial); s != `CREATE SEQUENCE "order_id_seq" AS integer START WITH 1 INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 CACHE 1 NO CYCLE` {
+		t.Fatalf("unexpected create sequence %q", s)
+		return
+	}
+	expected := []string{
+		`ALTER SEQUENCE "order_id_seq" OWNED BY "order"."id"`,
+		`SELECT pg_catalog.setval('"order_id_seq"', 42, true)`,
+	}
+	if got := buildSequenceValues(serial); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+		return
+	}
+
+	identity := &Sequence{
+		Name:        "item_id_seq",
+		DataType:    "bigint",
+		Start:       1,
+		Min:         1,
+		Max:         9223372036854775807,
+		Increment:   1,
+		Cache:       1,
+		OwnerTable:  "item",
+		OwnerColumn: "id",
+		Identity:    true,
+	}
+	column := buildColumn(&ColumnInfo{ColumnName: "id", FormatType: "bigint", IsNullable: "NO", Identity: "a", Sequence: identity})
+	if column != `"id" bigint GENERATED ALWAYS AS IDENTITY (SEQUENCE NAME "item_id_seq" START WITH 1 INCREMENT BY 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 NO CYCLE) NOT NULL` {
+		t.Fatalf("unexpected identity column %q", column)
+		return
+	}
+	// the identity sequence is owned by its column and was never used
+	if got := buildSequenceValues(identity); len(got) != 0 {
+		t.Fatalf("unexpected identity sequence values %q", got)
+	}
+}
+
+func TestBuildViews(t *testing.T) {
+	// the report reads the totals which read the orders table
+	views := sortViews([]*View{
+		{OID: 3, Name: "report", Kind: ViewKind, Definition: " SELECT total\n   FROM totals;", Options: "security_barrier=true", Dependencies: []int64{2}},
+		{OID: 2, Name: "totals", Kind: MaterializedViewKind, Definition: " SELECT sum(price) AS total\n   FROM orders;", Comment: "daily", Dependencies: []int64{1}},
+	})
+
+	expected := []string{
+		"CREATE MATERIALIZED VIEW \"totals\" AS\nSELECT sum(price) AS total\n   FROM orders\nWITH NO DATA",
+		`COMMENT ON MATERIALIZED VIEW "totals" IS 'daily'`,
+		"CREATE VIEW \"report\" WITH (security_barrier=true) AS\nSELECT total\n   FROM totals",
+	}
+	got := make([]string, 0)
+	for _, v := range views {
+		got = append(got, buildCreateView(v)...)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestBuildFunctions(t *testing.T) {
+	aggregate := buildCreateAggregate(&Aggregate{
+		Name:      "product",
+		Arguments: "numeric",
+		Kind:      "n",
+		TransFunc: "numeric_mul",
+		TransType: "numeric",
+		InitCond:  sql.NullString{String: "1", Valid: true},
+		Parallel:  "s",
+	})
+	if aggregate != "CREATE AGGREGATE \"product\"(numeric) (\n    SFUNC = numeric_mul,\n    STYPE = numeric,\n    INITCOND = '1',\n    PARALLEL = SAFE\n)" {
+		t.Fatalf("unexpected aggregate %q", aggregate)
+		return
+	}
+
+	// a moving sum with an inverse transition, like the built-in sum(int4)
+	aggregate = buildCreateAggregate(&Aggregate{
+		Name:          "msum",
+		Arguments:     "integer",
+		Kind:          "n",
+		TransFunc:     "int4_sum",
+		TransType:     "bigint",
+		FinalModify:   "r",
+		MTransFunc:    "int4_avg_accum",
+		MInvTransFunc: "int4_avg_accum_inv",
+		MTransType:    "bigint[]",
+		MFinalFunc:    "int2int4_sum",
+		MFinalModify:  "s",
+		MInitCond:     sql.NullString{String: "{0,0}", Valid: true},
+		Parallel:      "u",
+	})
+	if aggregate != "CREATE AGGREGATE \"msum\"(integer) (\n    SFUNC = int4_sum,\n    STYPE = bigint,\n    MSFUNC = int4_avg_accum,\n    MINVFUNC = int4_avg_accum_inv,\n    MSTYPE = bigint[],\n    MFINALFUNC = int2int4_sum,\n    MFINALFUNC_MODIFY = SHAREABLE,\n    MINITCOND = '{0,0}'\n)" {
+		t.Fatalf("unexpected aggregate %q", aggregate)
+		return
+	}
+
+	aggregate = buildCreateAggregate(&Aggregate{
+		Name:        "smallest",
+		Arguments:   "integer",
+		Kind:        "n",
+		TransFunc:   "int4smaller",
+		TransType:   "integer",
+		FinalModify: "w",
+		TransSpace:  64,
+		SortOp:      "OPERATOR(pg_catalog.<)",
+		Parallel:    "s",
+	})
+	if aggregate != "CREATE AGGREGATE \"smallest\"(integer) (\n    SFUNC = int4smaller,\n    STYPE = integer,\n    SSPACE = 64,\n    FINALFUNC_MODIFY = READ_WRITE,\n    SORTOP = OPERATOR(pg_catalog.<),\n    PARALLEL = SAFE\n)" {
+		t.Fatalf("unexpected aggregate %q", aggregate)
+		return
+	}
+
+	trigger := buildCreateTrigger(&Trigger{
+		Name:       "audit",
+		Table:      "order",
+		Definition: "CREATE TRIGGER audit AFTER INSERT ON public.\"order\" FOR EACH ROW EXECUTE FUNCTION audit()",
+		Disabled:   true,
+	})
+	if len(trigger) != 2 || trigger[1] != `ALTER TABLE "order" DISABLE TRIGGER "audit"` {
+		t.Fatalf("unexpected trigger %q", trigger)
+		return
+	}
+
+	// restore splits the dump on the semicolons outside of the function body
+	s := &bytes.Buffer{}
+	function := &Function{Definition: "CREATE OR REPLACE FUNCTION public.audit()\n RETURNS trigger\n LANGUAGE plpgsql\nAS $function$\nBEGIN\n  INSERT INTO log VALUES (NEW.id);\n  RETURN NEW;\nEND;\n$function$\n"}
+	if err := writeStatements(s, append([]string{buildCreateFunction(function)}, trigger...)); err != nil {
+		t.Fatal(err)
+		return
+	}
+	statements := make([]string, 0)
+	scanner := utils.NewStatementScanner(s)
+	for scanner.Scan() {
+		statements = append(statements, scanner.Text())
+	}
+	if len(statements) != 3 || !strings.HasSuffix(statements[0], "$function$") {
+		t.Fatalf("unexpected statements %q", statements)
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+		valid bool
+	}{
+		{&sql.NullString{String: "it's'); DROP TABLE users; --", Valid: true}, `'it''s''); DROP TABLE users; --'`, true},
+		{&sql.NullString{String: `C:\backups`, Valid: true}, ` E'C:\\backups'`, true},
+		{&sql.NullString{}, "", false},
+		{&sql.NullBool{Bool: true, Valid: true}, "true", true},
+		{&sql.NullBool{Bool: false, Valid: true}, "false", true},
+		{&sql.NullFloat64{Float64: 1.5, Valid: true}, "1.5", true},
+		{&sql.NullInt64{Int64: -42, Valid: true}, "-42", true},
+		{&sql.NullInt64{}, "", false},
+	}
+
+	for _, tt := range tests {
+		got, valid := literal(tt.value)
+		if valid != tt.valid || valid && got != tt.want {
+			t.Fatalf("literal of %+v is %q %v, want %q %v", tt.value, got, valid, tt.want, tt.valid)
+		}
+	}
+
+	// a quoted value stays within its statement on restore
+	statement := "INSERT INTO users (name) VALUES (" + `'it''s''); DROP TABLE users; --'` + ");\nSELECT 1;"
+	scanner := utils.NewStatementScanner(strings.NewReader(statement))
+	count := 0
+	for scanner.Scan() {
+		count++
+	}
+	if count != 2 {
+		t.Fatalf("scanned %d statements, want 2", count)
+	}
 }
@@ -0,0 +1,136 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+)
+
+// Sequence is a sequence of the dumped schema. Sequences of serial columns
+// are owned by their column, those of identity columns are created with it.
+type Sequence struct {
+	Name      string
+	DataType  string
+	Start     int64
+	Min       int64
+	Max       int64
+	Increment int64
+	Cache     int64
+	Cycle     bool
+	// LastValue is invalid until nextval was first called.
+	LastValue   sql.NullInt64
+	OwnerTable  string
+	OwnerColumn string
+	Identity    bool
+}
+
+func (d *DB) getSequences(ctx context.Context) ([]*Sequence, error) {
+	qb := squirrel.
+		Select(
+			"s.sequencename",
+			"s.data_type",
+			"s.start_value",
+			"s.min_value",
+			"s.max_value",
+			"s.increment_by",
+			"s.cache_size",
+			"s.cycle",
+			"s.last_value",
+			"t.relname",
+			"a.attname",
+			"COALESCE(dep.deptype = 'i', false)",
+		).
+		From("pg_sequences s").
+		PlaceholderFormat(squirrel.Dollar).
+		Join("pg_namespace n ON n.nspname = s.schemaname").
+		Join("pg_class c ON c.relnamespace = n.oid AND c.relname = s.sequencename").
+		LeftJoin("pg_depend dep ON dep.classid = 'pg_class'::regclass AND dep.objid = c.oid AND dep.refclassid = 'pg_class'::regclass AND dep.deptype IN ('a', 'i')").
+		LeftJoin("pg_class t ON t.oid = dep.refobjid").
+		LeftJoin("pg_attribute a ON a.attrelid = dep.refobjid AND a.attnum = dep.refobjsubid").
+		Where(squirrel.Eq{"s.schemaname": d.schema()}).
+		OrderBy("s.sequencename")
+
+	query, args, err := qb.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sequences := make([]*Sequence, 0)
+	for rows.Next() {
+		s := &Sequence{}
+		var ownerTable, ownerColumn sql.NullString
+		err := rows.Scan(
+			&s.Name,
+			&s.DataType,
+			&s.Start,
+			&s.Min,
+			&s.Max,
+			&s.Increment,
+			&s.Cache,
+			&s.Cycle,
+			&s.LastValue,
+			&ownerTable,
+			&ownerColumn,
+			&s.Identity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		s.OwnerTable, s.OwnerColumn = ownerTable.String, ownerColumn.String
+		sequences = append(sequences, s)
+	}
+
+	return sequences, rows.Err()
+}
+
+// buildCreateSequence returns the statement creating s, identity sequences
+// are created by buildColumn instead.
+func buildCreateSequence(s *Sequence) string {
+	return fmt.Sprintf("CREATE SEQUENCE %s AS %s %s", pq.QuoteIdentifier(s.Name), s.DataType, buildSequenceOptions(s))
+}
+
+func buildSequenceOptions(s *Sequence) string {
+	cycle := "NO CYCLE"
+	if s.Cycle {
+		cycle = "CYCLE"
+	}
+	return fmt.Sprintf(
+		"START WITH %d INCREMENT BY %d MINVALUE %d MAXVALUE %d CACHE %d %s",
+		s.Start,
+		s.Increment,
+		s.Min,
+		s.Max,
+		s.Cache,
+		cycle,
+	)
+}
+
+// buildSequenceValues returns the statements restoring the ownership and the
+// current value of s, to run once the data is loaded.
+func buildSequenceValues(s *Sequence) []string {
+	statements := make([]string, 0)
+	if len(s.OwnerTable) > 0 && !s.Identity {
+		statements = append(statements, fmt.Sprintf(
+			"ALTER SEQUENCE %s OWNED BY %s.%s",
+			pq.QuoteIdentifier(s.Name),
+			pq.QuoteIdentifier(s.OwnerTable),
+			pq.QuoteIdentifier(s.OwnerColumn),
+		))
+	}
+	if s.LastValue.Valid {
+		statements = append(statements, fmt.Sprintf(
+			"SELECT pg_catalog.setval(%s, %d, true)",
+			pq.QuoteLiteral(pq.QuoteIdentifier(s.Name)),
+			s.LastValue.Int64,
+		))
+	}
+	return statements
+}
@@ -0,0 +1,170 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+	"strings"
+)
+
+const (
+	ViewKind             = "v"
+	MaterializedViewKind = "m"
+)
+
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// View is a view or a materialized view, Definition is the output of
+// pg_get_viewdef.
+type View struct {
+	OID        int64
+	Name       string
+	Kind       string
+	Definition string
+	Options    string
+	Comment    string
+	// Dependencies holds the OIDs of the relations the view reads.
+	Dependencies []int64
+	Indexes      []string
+}
+
+// getViews returns the views of the schema, each one after the views it
+// depends on.
+func (d *DB) getViews(ctx context.Context, q queryer) ([]*View, error) {
+	qb := squirrel.
+		Select(
+			"c.oid",
+			"c.relname",
+			"c.relkind",
+			"pg_get_viewdef(c.oid, true)",
+			"COALESCE(array_to_string(c.reloptions, ', '), '')",
+			"COALESCE(obj_description(c.oid, 'pg_class'), '')",
+		).
+		From("pg_class c").
+		PlaceholderFormat(squirrel.Dollar).
+		Join("pg_namespace n ON n.oid = c.relnamespace").
+		Where(squirrel.Eq{"n.nspname": d.schema()}).
+		Where(squirrel.Eq{"c.relkind": []string{ViewKind, MaterializedViewKind}}).
+		OrderBy("c.relname")
+
+	query, args, err := qb.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	views := make([]*View, 0)
+	byOID := make(map[int64]*View)
+	for rows.Next() {
+		v := &View{}
+		if err := rows.Scan(&v.OID, &v.Name, &v.Kind, &v.Definition, &v.Options, &v.Comment); err != nil {
+			return nil, err
+		}
+		views = append(views, v)
+		byOID[v.OID] = v
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// a view depends on the relations used by its rewrite rule
+	qb = squirrel.
+		Select("DISTINCT r.ev_class", "dep.refobjid").
+		From("pg_rewrite r").
+		PlaceholderFormat(squirrel.Dollar).
+		Join("pg_depend dep ON dep.classid = 'pg_rewrite'::regclass AND dep.objid = r.oid AND dep.refclassid = 'pg_class'::regclass AND dep.refobjid <> r.ev_class").
+		Join("pg_class c ON c.oid = r.ev_class").
+		Join("pg_namespace n ON n.oid = c.relnamespace").
+		Where(squirrel.Eq{"n.nspname": d.schema()})
+
+	query, args, err = qb.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	dependencies, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer dependencies.Close()
+
+	for dependencies.Next() {
+		var view, dependency int64
+		if err := dependencies.Scan(&view, &dependency); err != nil {
+			return nil, err
+		}
+		if v, ok := byOID[view]; ok {
+			v.Dependencies = append(v.Dependencies, dependency)
+		}
+	}
+	if err := dependencies.Err(); err != nil {
+		return nil, err
+	}
+
+	return sortViews(views), nil
+}
+
+// sortViews orders views so that each view follows the views it depends on,
+// keeping the given order otherwise.
+func sortViews(views []*View) []*View {
+	byOID := make(map[int64]*View)
+	for _, v := range views {
+		byOID[v.OID] = v
+	}
+
+	sorted := make([]*View, 0, len(views))
+	visited := make(map[int64]bool)
+	var visit func(v *View)
+	visit = func(v *View) {
+		if visited[v.OID] {
+			return
+		}
+		visited[v.OID] = true
+		for _, oid := range v.Dependencies {
+			if dependency, ok := byOID[oid]; ok {
+				visit(dependency)
+			}
+		}
+		sorted = append(sorted, v)
+	}
+	for _, v := range views {
+		visit(v)
+	}
+
+	return sorted
+}
+
+// buildCreateView returns the statement creating v followed by its comment.
+// Materialized views are created empty, see DB.Restore.
+func buildCreateView(v *View) []string {
+	kind := "VIEW"
+	if v.Kind == MaterializedViewKind {
+		kind = "MATERIALIZED VIEW"
+	}
+
+	name := pq.QuoteIdentifier(v.Name)
+	create := fmt.Sprintf("CREATE %s %s", kind, name)
+	if len(v.Options) > 0 {
+		create += fmt.Sprintf(" WITH (%s)", v.Options)
+	}
+	create += " AS\n" + strings.TrimRight(strings.TrimSpace(v.Definition), ";")
+	if v.Kind == MaterializedViewKind {
+		create += "\nWITH NO DATA"
+	}
+
+	statements := []string{create}
+	if len(v.Comment) > 0 {
+		statements = append(statements, fmt.Sprintf("COMMENT ON %s %s IS %s", kind, name, pq.QuoteLiteral(v.Comment)))
+	}
+	return statements
+}
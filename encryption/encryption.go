@@ -0,0 +1,178 @@
+package encryption
+
+import (
+	"crypto/sha256"
+	"errors"
+	"filippo.io/age"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	None   = ""
+	Age    = "age"
+	AESGCM = "aes-gcm"
+)
+
+var extensions = map[string]string{
+	Age:    ".age",
+	AESGCM: ".enc",
+}
+
+type Config struct {
+	Type string `yaml:"type"`
+	// Recipients are the age public keys a backup is encrypted to and
+	// IdentityFile holds the private keys used to decrypt it.
+	Recipients   []string `yaml:"recipients,omitempty"`
+	IdentityFile string   `yaml:"identity_file,omitempty"`
+	// Passphrase or KeyFile derive the AES-256-GCM key.
+	Passphrase string `yaml:"passphrase,omitempty"`
+	KeyFile    string `yaml:"key_file,omitempty"`
+}
+
+// Extension returns the file extension of the encryption type t.
+func Extension(t string) string {
+	return extensions[t]
+}
+
+// FromName guesses the encryption type from the extension of an artifact name.
+func FromName(name string) string {
+	for t, ext := range extensions {
+		if strings.HasSuffix(name, ext) {
+			return t
+		}
+	}
+	return None
+}
+
+// NewWriter returns a writer encrypting to w, closing it writes the end of
+// the encrypted stream but does not close w.
+func NewWriter(w io.Writer, c *Config) (io.WriteCloser, error) {
+	if c == nil {
+		return nopCloser{w}, nil
+	}
+
+	switch c.Type {
+	case None:
+		return nopCloser{w}, nil
+	case Age:
+		if len(c.Recipients) == 0 {
+			return nil, errors.New("missing recipients for age encryption")
+		}
+		recipients, err := age.ParseRecipients(strings.NewReader(strings.Join(c.Recipients, "\n")))
+		if err != nil {
+			return nil, err
+		}
+		return age.Encrypt(w, recipients...)
+	case AESGCM:
+		secret, kdf, err := c.secret()
+		if err != nil {
+			return nil, err
+		}
+		return newStreamWriter(w, secret, kdf)
+	}
+
+	return nil, fmt.Errorf("unknown encryption type %s", c.Type)
+}
+
+// NewReader returns a reader decrypting r, which was encrypted with t.
+func NewReader(r io.Reader, t string, c *Config) (io.Reader, error) {
+	if t == None {
+		return r, nil
+	}
+	if c == nil {
+		return nil, fmt.Errorf("backup is encrypted with %s but encryption is not configured", t)
+	}
+
+	switch t {
+	case Age:
+		if len(c.IdentityFile) == 0 {
+			return nil, errors.New("missing identity file for age decryption")
+		}
+		f, err := os.Open(c.IdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		identities, err := age.ParseIdentities(f)
+		if err != nil {
+			return nil, err
+		}
+		return age.Decrypt(r, identities...)
+	case AESGCM:
+		secret, _, err := c.secret()
+		if err != nil {
+			return nil, err
+		}
+		return newStreamReader(r, secret)
+	}
+
+	return nil, fmt.Errorf("unknown encryption type %s", t)
+}
+
+// chunkKeySalt separates the chunk key from the keys of the encrypted streams,
+// which are derived with a random salt.
+var chunkKeySalt = []byte("RWB chunk key")
+
+// ChunkKey returns the key naming the deduplicated chunks encrypted with c,
+// nil when c does not encrypt. Age only holds public keys while backing up,
+// its chunk key is derived from the recipients and only hides the content from
+// whoever does not know them.
+func (c *Config) ChunkKey() ([]byte, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	switch c.Type {
+	case None:
+		return nil, nil
+	case Age:
+		if len(c.Recipients) == 0 {
+			return nil, errors.New("missing recipients for age encryption")
+		}
+		recipients := append([]string{}, c.Recipients...)
+		sort.Strings(recipients)
+		sum := sha256.Sum256([]byte(strings.Join(recipients, "\n")))
+		return deriveKey(sum[:], kdfHKDF, chunkKeySalt)
+	case AESGCM:
+		secret, kdf, err := c.secret()
+		if err != nil {
+			return nil, err
+		}
+		return deriveKey(secret, kdf, chunkKeySalt)
+	}
+
+	return nil, fmt.Errorf("unknown encryption type %s", c.Type)
+}
+
+func (c *Config) secret() ([]byte, byte, error) {
+	if len(c.Passphrase) > 0 {
+		return []byte(c.Passphrase), kdfScrypt, nil
+	}
+
+	if len(c.KeyFile) > 0 {
+		key, err := os.ReadFile(c.KeyFile)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(key) < 32 {
+			return nil, 0, fmt.Errorf("key file %s must hold at least 32 bytes", c.KeyFile)
+		}
+		return key, kdfHKDF, nil
+	}
+
+	return nil, 0, errors.New("missing passphrase or key file for aes-gcm encryption")
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,112 @@
+package encryption
+
+import (
+	"bytes"
+	"filippo.io/age"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	identityFile := path.Join(t.TempDir(), "identity.txt")
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+		return
+	}
+	keyFile := path.Join(t.TempDir(), "backup.key")
+	if err := os.WriteFile(keyFile, bytes.Repeat([]byte{42}, 32), 0600); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	configs := []*Config{
+		{Type: Age, Recipients: []string{identity.Recipient().String()}, IdentityFile: identityFile},
+		{Type: AESGCM, Passphrase: "correct horse battery staple"},
+		{Type: AESGCM, KeyFile: keyFile},
+	}
+	contents := []string{
+		"",
+		"SELECT 1;",
+		strings.Repeat("a", chunkSize),
+		strings.Repeat("INSERT INTO users (id) VALUES (1);\n", 5000),
+	}
+
+	for _, c := range configs {
+		for _, content := range contents {
+			encrypted := encrypt(t, c, content)
+			if len(content) > 0 && bytes.Contains(encrypted, []byte(content)) {
+				t.Fatalf("%s leaked the plaintext", c.Type)
+			}
+
+			r, err := NewReader(bytes.NewReader(encrypted), FromName("1-app.sql"+Extension(c.Type)), c)
+			if err != nil {
+				t.Fatal(err)
+				return
+			}
+			b, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+				return
+			}
+			if string(b) != content {
+				t.Fatalf("%s round trip mismatch for %d bytes", c.Type, len(content))
+			}
+		}
+	}
+}
+
+func TestEncryption_Tampering(t *testing.T) {
+	c := &Config{Type: AESGCM, Passphrase: "secret"}
+	encrypted := encrypt(t, c, strings.Repeat("a", 3*chunkSize))
+
+	tests := map[string][]byte{
+		"truncated": encrypted[:len(encrypted)-chunkSize-16],
+		"flipped":   append(append([]byte{}, encrypted[:100]...), append([]byte{encrypted[100] ^ 1}, encrypted[101:]...)...),
+	}
+	for name, data := range tests {
+		r, err := NewReader(bytes.NewReader(data), AESGCM, c)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if _, err := io.ReadAll(r); err == nil {
+			t.Fatalf("expected error for %s stream", name)
+		}
+	}
+
+	r, err := NewReader(bytes.NewReader(encrypted), AESGCM, &Config{Type: AESGCM, Passphrase: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if _, err := io.ReadAll(r); err == nil {
+		t.Fatal("expected error for wrong passphrase")
+	}
+
+	if _, err := NewReader(bytes.NewReader(encrypted), AESGCM, nil); err == nil {
+		t.Fatal("expected error without encryption config")
+	}
+}
+
+func encrypt(t *testing.T, c *Config, content string) []byte {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
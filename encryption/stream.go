@@ -0,0 +1,224 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+	"io"
+)
+
+// The aes-gcm stream is a header followed by chunks of chunkSize plaintext
+// bytes, each sealed with AES-256-GCM (the STREAM construction): the nonce is
+// a random prefix, the chunk counter and a flag set on the last chunk, so
+// truncated, reordered or spliced streams fail to decrypt.
+//
+//	magic | kdf | salt | nonce prefix | chunk... | last chunk
+const (
+	chunkSize = 64 * 1024
+	saltSize  = 16
+	// prefixSize leaves 4 bytes for the chunk counter and 1 for the last flag.
+	prefixSize = 7
+
+	kdfScrypt byte = 1
+	kdfHKDF   byte = 2
+)
+
+var magic = []byte("RWBENC1\n")
+
+func deriveKey(secret []byte, kdf byte, salt []byte) ([]byte, error) {
+	switch kdf {
+	case kdfScrypt:
+		return scrypt.Key(secret, salt, 1<<15, 8, 1, 32)
+	case kdfHKDF:
+		key := make([]byte, 32)
+		_, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, magic), key)
+		return key, err
+	}
+
+	return nil, fmt.Errorf("unknown key derivation %d", kdf)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+type stream struct {
+	aead    cipher.AEAD
+	header  []byte
+	nonce   []byte
+	counter uint32
+}
+
+func (s *stream) nextNonce(last bool) ([]byte, error) {
+	if s.counter == ^uint32(0) {
+		return nil, errors.New("encrypted stream is too long")
+	}
+	binary.BigEndian.PutUint32(s.nonce[prefixSize:], s.counter)
+	s.nonce[len(s.nonce)-1] = 0
+	if last {
+		s.nonce[len(s.nonce)-1] = 1
+	}
+	s.counter++
+	return s.nonce, nil
+}
+
+type streamWriter struct {
+	stream
+	w   io.Writer
+	buf []byte
+}
+
+func newStreamWriter(w io.Writer, secret []byte, kdf byte) (*streamWriter, error) {
+	header := make([]byte, len(magic)+1+saltSize+prefixSize)
+	copy(header, magic)
+	header[len(magic)] = kdf
+	if _, err := rand.Read(header[len(magic)+1:]); err != nil {
+		return nil, err
+	}
+
+	key, err := deriveKey(secret, kdf, header[len(magic)+1:len(magic)+1+saltSize])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, header[len(header)-prefixSize:])
+	return &streamWriter{
+		stream: stream{aead: aead, header: header, nonce: nonce},
+		w:      w,
+		buf:    make([]byte, 0, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// a full chunk is only sealed once more data shows it is not the last
+		if len(s.buf) == chunkSize {
+			if err := s.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(s.buf[len(s.buf):chunkSize], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (s *streamWriter) Close() error {
+	return s.flush(true)
+}
+
+func (s *streamWriter) flush(last bool) error {
+	nonce, err := s.nextNonce(last)
+	if err != nil {
+		return err
+	}
+	sealed := s.aead.Seal(s.buf[:0], nonce, s.buf, s.header)
+	_, err = s.w.Write(sealed)
+	s.buf = s.buf[:0]
+	return err
+}
+
+type streamReader struct {
+	stream
+	r    *bufio.Reader
+	buf  []byte
+	out  []byte
+	done bool
+}
+
+func newStreamReader(r io.Reader, secret []byte) (*streamReader, error) {
+	header := make([]byte, len(magic)+1+saltSize+prefixSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("cannot read encryption header: %w", err)
+	}
+	if !bytes.Equal(header[:len(magic)], magic) {
+		return nil, errors.New("not an aes-gcm encrypted backup")
+	}
+
+	key, err := deriveKey(secret, header[len(magic)], header[len(magic)+1:len(magic)+1+saltSize])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, header[len(header)-prefixSize:])
+	return &streamReader{
+		stream: stream{aead: aead, header: header, nonce: nonce},
+		r:      bufio.NewReaderSize(r, chunkSize+aead.Overhead()+1),
+		buf:    make([]byte, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+func (s *streamReader) next() error {
+	n, err := io.ReadFull(s.r, s.buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return errors.New("encrypted backup is truncated")
+		}
+		return err
+	}
+
+	// the last chunk is the one followed by the end of the stream
+	last := err == io.ErrUnexpectedEOF
+	if !last {
+		if _, err := s.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	nonce, err := s.nextNonce(last)
+	if err != nil {
+		return err
+	}
+	s.out, err = s.aead.Open(s.buf[:0], nonce, s.buf[:n], s.header)
+	if err != nil {
+		return errors.New("cannot decrypt backup, wrong key or corrupted data")
+	}
+	s.done = last
+	return nil
+}
@@ -2,17 +2,35 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"react-web-backup/compression"
 	"react-web-backup/database"
 	_ "react-web-backup/database/mysql"
+	_ "react-web-backup/database/pg"
+	"react-web-backup/encryption"
+	"react-web-backup/manifest"
 	"react-web-backup/storage"
+	_ "react-web-backup/storage/azblob"
 	_ "react-web-backup/storage/file"
+	_ "react-web-backup/storage/ftp"
+	_ "react-web-backup/storage/gcs"
+	"react-web-backup/storage/repository"
+	_ "react-web-backup/storage/s3"
+	_ "react-web-backup/storage/sftp"
+	_ "react-web-backup/storage/webdav"
+	"strings"
+	"text/tabwriter"
 	"time"
 )
 
 var (
 	configPath string
+	// version is set at build time with -ldflags "-X main.version=..."
+	version = "dev"
 )
 
 func init() {
@@ -30,21 +48,97 @@ func main() {
 	c, err := getConfig(configPath)
 	if err != nil {
 		panic(err)
-		return
 	}
 
-	if c.Storage == nil {
+	switch c.Action {
+	case "backup":
+		if len(c.SpoolDir) == 0 {
+			warnStreamedRetry(c)
+		}
+		backup(ctx, connect(ctx, c), getStorages(c), c)
+	case "restore":
+		restore(ctx, connect(ctx, c), findBackup(getStorages(c), c.RestoreVersion), c)
+	case "list":
+		list(getStorages(c))
+	case "prune":
+		for _, s := range getStorages(c) {
+			prune(s, c)
+		}
+	case "copy":
+		copyBackups(c)
+	case "resume":
+		resumeSpooled(getStorages(c), c)
+	}
+}
+
+// storageConfigs returns the configs of the storages backups go to, in the
+// order of getStorages.
+func storageConfigs(c *Config) []*storage.StorageConfig {
+	configs := c.Storages
+	if c.Storage != nil {
+		configs = append([]*storage.StorageConfig{c.Storage}, configs...)
+	}
+
+	if len(configs) == 0 {
 		panic("missing storage config")
 	}
+	return configs
+}
 
-	if c.Database == nil {
-		panic("missing database config")
+// warnStreamedRetry tells that the retry config of the storages of c does not
+// cover the upload of a streamed backup, whose content cannot be read again.
+func warnStreamedRetry(c *Config) {
+	for _, sc := range storageConfigs(c) {
+		if sc.Retry != nil {
+			fmt.Println("Warning: failed backup uploads are only retried with spool_dir set, retry covers the other storage operations")
+			return
+		}
+	}
+}
+
+// getStorages returns the storage followed by the extra storages of c, every
+// backup is uploaded to all of them.
+func getStorages(c *Config) []storage.Storage {
+	storages := make([]storage.Storage, 0)
+	for _, sc := range storageConfigs(c) {
+		storages = append(storages, newStorage(sc, c))
 	}
 
-	s, err := storage.GetStorage(c.Storage)
+	return storages
+}
+
+func newStorage(sc *storage.StorageConfig, c *Config) storage.Storage {
+	s, err := storage.GetStorage(sc)
 	if err != nil {
 		panic(err)
 	}
+	if sc.Repository {
+		s = repository.New(s, c.Compression, c.Encryption)
+	}
+
+	return s
+}
+
+// isRepository reports whether the backups go to deduplicating repositories,
+// which compress and encrypt each chunk instead of the whole dump.
+func isRepository(storages []storage.Storage) bool {
+	repositories := 0
+	for _, s := range storages {
+		if _, ok := s.(*repository.Repository); ok {
+			repositories++
+		}
+	}
+
+	if repositories > 0 && repositories < len(storages) {
+		panic("repository storages cannot be mixed with other storages")
+	}
+	return repositories > 0
+}
+
+func connect(ctx context.Context, c *Config) database.Database {
+	if c.Database == nil {
+		panic("missing database config")
+	}
 
 	if c.Tunnel != nil {
 		c.Tunnel.Start()
@@ -55,45 +149,213 @@ func main() {
 		panic(err)
 	}
 
-	switch c.Action {
-	case "backup":
-		backup(ctx, db, s, c)
-	case "restore":
-		restore(ctx, db, s, c)
-	}
+	return db
 }
 
-func backup(ctx context.Context, db database.Database, s storage.Storage, c *Config) {
-	sql, err := db.Backup(ctx)
+func backup(ctx context.Context, db database.Database, storages []storage.Storage, c *Config) {
+	compressionConfig, encryptionConfig := c.Compression, c.Encryption
+	if isRepository(storages) {
+		compressionConfig, encryptionConfig = nil, nil
+	}
+
+	codec := compression.None
+	if compressionConfig != nil {
+		codec = compressionConfig.Codec
+	}
+	method := encryption.None
+	if encryptionConfig != nil {
+		method = encryptionConfig.Type
+	}
+
+	startedAt := time.Now()
+	m := &manifest.Manifest{
+		Version:     manifest.Version,
+		Artifact:    backupFileName(c.Database.Name, startedAt) + compression.Extension(codec) + encryption.Extension(method),
+		Client:      c.Database.Client,
+		Database:    c.Database.Name,
+		Schema:      c.Database.Schema,
+		StartedAt:   startedAt,
+		ToolVersion: version,
+		Compression: codec,
+		Encryption:  method,
+	}
+
+	if len(c.SpoolDir) > 0 {
+		spool(ctx, db, m, compressionConfig, encryptionConfig, c.SpoolDir)
+		resume(storages, m, c)
+		return
+	}
+
+	r, w := io.Pipe()
+	defer func() {
+		_ = r.Close()
+	}()
+	tables := make(chan []database.Table, 1)
+	go func() {
+		t, err := dump(ctx, db, w, compressionConfig, encryptionConfig)
+		tables <- t
+		_ = w.CloseWithError(err)
+	}()
+
+	digest := manifest.NewDigest()
+	results, err := storage.UploadAll(storages, m.Artifact, io.TeeReader(r, digest), c.StoragePolicy)
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("Backup to %s failed: %v\n", result.Storage.Name(), result.Err)
+		}
+	}
 	if err != nil {
 		panic(err)
 	}
 
-	currentTime := time.Now()
-	fileName := fmt.Sprintf(
+	m.Tables = <-tables
+	m.Size = digest.Size()
+	m.SHA256 = digest.Sum()
+	m.FinishedAt = time.Now()
+	finish(results, m, c)
+}
+
+// finish writes the manifest m next to each successful upload of its backup
+// and applies the retention policy there.
+func finish(results []storage.Result, m *manifest.Manifest, c *Config) {
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+
+		if err := manifest.Write(result.Storage, m); err != nil {
+			panic(err)
+		}
+		fmt.Printf("Backup was saved at %s\n", result.Path)
+
+		if c.Retention != nil {
+			prune(result.Storage, c)
+		}
+	}
+}
+
+// dump writes the backup of db to w, compressed then encrypted as configured.
+func dump(ctx context.Context, db database.Database, w io.Writer, compressionConfig *compression.Config, encryptionConfig *encryption.Config) ([]database.Table, error) {
+	ew, err := encryption.NewWriter(w, encryptionConfig)
+	if err != nil {
+		return nil, err
+	}
+	cw, err := compression.NewWriter(ew, compressionConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := db.Backup(ctx, cw)
+	if err != nil {
+		return nil, err
+	}
+	if err := cw.Close(); err != nil {
+		return nil, err
+	}
+
+	return tables, ew.Close()
+}
+
+func backupFileName(dbName string, currentTime time.Time) string {
+	return fmt.Sprintf(
 		"%d%d%d%d%d-%s.sql",
 		currentTime.Day(),
 		currentTime.Month(),
 		currentTime.Year(),
 		currentTime.Hour(),
 		currentTime.Minute(),
-		c.Database.Name,
+		dbName,
 	)
+}
 
-	filePath, err := s.Upload(fileName, sql)
-	if err != nil {
-		panic(err)
+// isBackupFile reports whether name was produced by backupFileName for dbName.
+func isBackupFile(name string, dbName string) bool {
+	timestamp, rest, ok := strings.Cut(name, "-")
+	if !ok || len(timestamp) == 0 || strings.Trim(timestamp, "0123456789") != "" {
+		return false
 	}
-	fmt.Printf("Backup was saved at %s", filePath)
+
+	ext, ok := strings.CutPrefix(rest, dbName+".sql")
+	if !ok {
+		return false
+	}
+	ext = strings.TrimSuffix(ext, encryption.Extension(encryption.FromName(ext)))
+	return ext == compression.Extension(compression.FromName(ext))
 }
 
 func restore(ctx context.Context, db database.Database, s storage.Storage, c *Config) {
-	restoreFileContent, err := s.GetContent(c.RestoreVersion)
+	method := encryption.FromName(c.RestoreVersion)
+	codec := compression.FromName(strings.TrimSuffix(c.RestoreVersion, encryption.Extension(method)))
+	m, err := manifest.Read(s, c.RestoreVersion)
+	switch {
+	case err == nil:
+		if err := m.Validate(c.Database.Client); err != nil {
+			panic(err)
+		}
+		codec = m.Compression
+		method = m.Encryption
+	case errors.Is(err, storage.ErrNotExist):
+		// backups taken before manifests existed
+	default:
+		panic(err)
+	}
+
+	content, err := s.GetContent(c.RestoreVersion)
 	if err != nil {
 		panic(err)
 	}
-	err = db.Restore(ctx, restoreFileContent)
+	defer func() {
+		_ = content.Close()
+	}()
+
+	dr, err := encryption.NewReader(content, method, c.Encryption)
 	if err != nil {
 		panic(err)
 	}
+	r, err := compression.NewReader(dr, codec)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	err = db.Restore(ctx, r)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// findBackup returns the first storage holding the backup name.
+func findBackup(storages []storage.Storage, name string) storage.Storage {
+	for _, s := range storages {
+		objects, err := s.List(name)
+		if err != nil {
+			fmt.Printf("Cannot list %s: %v\n", s.Name(), err)
+			continue
+		}
+		for _, o := range objects {
+			if o.Name == name {
+				return s
+			}
+		}
+	}
+
+	panic(fmt.Sprintf("cannot find backup %s", name))
+}
+
+func list(storages []storage.Storage) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "STORAGE\tNAME\tSIZE\tMODIFIED")
+	for i, s := range storages {
+		objects, err := s.List("")
+		if err != nil {
+			panic(err)
+		}
+
+		for _, o := range objects {
+			_, _ = fmt.Fprintf(w, "%d:%s\t%s\t%d\t%s\n", i, s.Name(), o.Name, o.Size, o.ModTime.Format(time.RFC3339))
+		}
+	}
+	_ = w.Flush()
 }
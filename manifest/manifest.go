@@ -0,0 +1,112 @@
+package manifest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"react-web-backup/database"
+	"react-web-backup/storage"
+	"strings"
+	"time"
+)
+
+// Version is the manifest format written by this tool, manifests with a
+// greater version cannot be understood.
+const Version = 1
+
+// Extension is appended to the artifact name to get its manifest name.
+const Extension = ".manifest.json"
+
+type Manifest struct {
+	Version     int              `json:"version"`
+	Artifact    string           `json:"artifact"`
+	Client      string           `json:"client"`
+	Database    string           `json:"database"`
+	Schema      string           `json:"schema,omitempty"`
+	Tables      []database.Table `json:"tables"`
+	Size        int64            `json:"size"`
+	SHA256      string           `json:"sha256"`
+	StartedAt   time.Time        `json:"started_at"`
+	FinishedAt  time.Time        `json:"finished_at"`
+	ToolVersion string           `json:"tool_version"`
+	Compression string           `json:"compression,omitempty"`
+	Encryption  string           `json:"encryption,omitempty"`
+}
+
+// Name returns the name of the manifest describing artifact.
+func Name(artifact string) string {
+	return artifact + Extension
+}
+
+func IsManifest(name string) bool {
+	return strings.HasSuffix(name, Extension)
+}
+
+// Write stores m next to the artifact it describes.
+func Write(s storage.Storage, m *Manifest) error {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Upload(Name(m.Artifact), bytes.NewReader(content))
+	return err
+}
+
+// Read loads the manifest of artifact, the returned error wraps
+// storage.ErrNotExist when the artifact has no manifest.
+func Read(s storage.Storage, artifact string) (*Manifest, error) {
+	content, err := s.GetContent(Name(artifact))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	m := &Manifest{}
+	if err := json.NewDecoder(content).Decode(m); err != nil {
+		return nil, fmt.Errorf("invalid manifest for %s: %w", artifact, err)
+	}
+
+	return m, nil
+}
+
+// Validate checks that the artifact can be restored with the database client.
+func (m *Manifest) Validate(client string) error {
+	if m.Version > Version {
+		return fmt.Errorf("manifest version %d of %s is not supported, upgrade the tool", m.Version, m.Artifact)
+	}
+
+	if !strings.EqualFold(m.Client, client) {
+		return fmt.Errorf("%s is a %s backup and cannot be restored with %s", m.Artifact, m.Client, client)
+	}
+
+	return nil
+}
+
+// Digest computes the size and SHA-256 of everything written to it.
+type Digest struct {
+	hash hash.Hash
+	size int64
+}
+
+func NewDigest() *Digest {
+	return &Digest{hash: sha256.New()}
+}
+
+func (d *Digest) Write(p []byte) (int, error) {
+	d.size += int64(len(p))
+	return d.hash.Write(p)
+}
+
+func (d *Digest) Size() int64 {
+	return d.size
+}
+
+func (d *Digest) Sum() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
@@ -0,0 +1,71 @@
+package manifest
+
+import (
+	"errors"
+	"io"
+	"react-web-backup/database"
+	"react-web-backup/storage"
+	_ "react-web-backup/storage/file"
+	"strings"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	s, err := storage.GetStorage(&storage.StorageConfig{
+		Client:  "file",
+		Options: storage.Options{StoragePath: t.TempDir()},
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	content := "INSERT INTO users (id) VALUES (1);"
+	digest := NewDigest()
+	_, err = s.Upload("1-app.sql", io.TeeReader(strings.NewReader(content), digest))
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	err = Write(s, &Manifest{
+		Version:  Version,
+		Artifact: "1-app.sql",
+		Client:   "pg",
+		Database: "app",
+		Tables:   []database.Table{{Name: "users", Rows: 1}},
+		Size:     digest.Size(),
+		SHA256:   digest.Sum(),
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	m, err := Read(s, "1-app.sql")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if m.Size != int64(len(content)) || m.SHA256 != "fbf7c0b61f1a44b0e699ab15a0f2f25531160c369e0e27b614e9c6375b6de2b6" {
+		t.Fatalf("unexpected digest %d %s", m.Size, m.SHA256)
+	}
+	if len(m.Tables) != 1 || m.Tables[0].Rows != 1 {
+		t.Fatalf("unexpected tables %+v", m.Tables)
+	}
+
+	if err := m.Validate("pg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Validate("mysql"); err == nil {
+		t.Fatal("expected client mismatch error")
+	}
+	m.Version = Version + 1
+	if err := m.Validate("pg"); err == nil {
+		t.Fatal("expected version error")
+	}
+
+	if _, err := Read(s, "2-app.sql"); !errors.Is(err, storage.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"react-web-backup/manifest"
+	"react-web-backup/retention"
+	"react-web-backup/storage"
+	"react-web-backup/storage/repository"
+	"time"
+)
+
+func prune(s storage.Storage, c *Config) {
+	if c.Retention == nil {
+		panic("missing retention config")
+	}
+
+	if c.Database == nil {
+		panic("missing database config")
+	}
+
+	objects, err := s.List("")
+	if err != nil {
+		panic(err)
+	}
+
+	backups := make([]retention.Backup, 0)
+	for _, o := range objects {
+		if isBackupFile(o.Name, c.Database.Name) {
+			backups = append(backups, retention.Backup{Object: o, TakenAt: takenAt(s, o)})
+		}
+	}
+
+	_, remove := c.Retention.Apply(backups, time.Now())
+	for _, o := range remove {
+		if c.Retention.DryRun {
+			fmt.Printf("Would delete %s\n", o.Name)
+			continue
+		}
+
+		// the manifest is written after the backup and stays immutable for
+		// longer, it goes first so that a backup never loses it
+		err := s.Delete(manifest.Name(o.Name))
+		if errors.Is(err, storage.ErrImmutable) {
+			fmt.Printf("Keeping %s: %v\n", o.Name, err)
+			continue
+		}
+		if err != nil && !errors.Is(err, storage.ErrNotExist) {
+			panic(err)
+		}
+		if err := s.Delete(o.Name); err != nil {
+			if errors.Is(err, storage.ErrImmutable) {
+				fmt.Printf("Keeping %s: %v\n", o.Name, err)
+				continue
+			}
+			panic(err)
+		}
+		fmt.Printf("Deleted %s\n", o.Name)
+	}
+
+	if r, ok := s.(*repository.Repository); ok && !c.Retention.DryRun && len(remove) > 0 {
+		if err := r.Collect(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// takenAt returns when the backup o was started according to its manifest,
+// backups without manifest fall back to the time they were stored.
+func takenAt(s storage.Storage, o storage.Object) time.Time {
+	m, err := manifest.Read(s, o.Name)
+	switch {
+	case err == nil:
+		return m.StartedAt
+	case errors.Is(err, storage.ErrNotExist):
+		return o.ModTime
+	default:
+		panic(err)
+	}
+}
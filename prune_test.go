@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"react-web-backup/database"
+	"react-web-backup/manifest"
+	"react-web-backup/retention"
+	"react-web-backup/storage"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStorage(t *testing.T) storage.Storage {
+	s, err := storage.GetStorage(&storage.StorageConfig{
+		Client:  "file",
+		Options: storage.Options{StoragePath: t.TempDir()},
+	})
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	return s
+}
+
+// putBackup stores a backup of the database app taken at startedAt, with its
+// manifest.
+func putBackup(t *testing.T, s storage.Storage, startedAt time.Time, content string) *manifest.Manifest {
+	digest := manifest.NewDigest()
+	_, _ = digest.Write([]byte(content))
+	m := &manifest.Manifest{
+		Version:   manifest.Version,
+		Artifact:  backupFileName("app", startedAt),
+		Client:    "pg",
+		Database:  "app",
+		StartedAt: startedAt,
+		Size:      digest.Size(),
+		SHA256:    digest.Sum(),
+	}
+
+	if _, err := s.Upload(m.Artifact, strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	if err := manifest.Write(s, m); err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	return m
+}
+
+func TestPrune(t *testing.T) {
+	s := newTestStorage(t)
+
+	// a year of daily backups migrated today, their files are all new
+	now := time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 365; i++ {
+		putBackup(t, s, now.AddDate(0, 0, -i), "SELECT 1;")
+	}
+
+	prune(s, &Config{
+		Database:  &database.Connection{Name: "app"},
+		Retention: &retention.Policy{KeepDaily: 7, KeepMonthly: 12},
+	})
+
+	// the last 7 days, then the last day of the 11 previous months
+	expected := make(map[string]bool)
+	for i := 0; i < 7; i++ {
+		expected[backupFileName("app", now.AddDate(0, 0, -i))] = true
+	}
+	for i := 0; i < 11; i++ {
+		endOfMonth := time.Date(2022, 6-time.Month(i), 0, 12, 0, 0, 0, time.UTC)
+		expected[backupFileName("app", endOfMonth)] = true
+	}
+
+	objects, err := s.List("")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	kept := make(map[string]bool)
+	for _, o := range objects {
+		kept[strings.TrimSuffix(o.Name, manifest.Extension)] = true
+	}
+	if len(objects) != 2*len(expected) || !reflect.DeepEqual(kept, expected) {
+		t.Fatalf("kept %d objects %v, want %v", len(objects), kept, expected)
+	}
+}
+
+func TestPrune_Immutable(t *testing.T) {
+	dir := t.TempDir()
+	s, err := storage.GetStorage(&storage.StorageConfig{
+		Client:  "file",
+		Options: storage.Options{StoragePath: dir, ImmutableDays: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	now := time.Now().UTC()
+	old := putBackup(t, s, now.AddDate(0, 0, -10), "SELECT 1;")
+	putBackup(t, s, now, "SELECT 2;")
+	// the backup expired before its manifest, written once it was stored
+	if err := os.Remove(filepath.Join(dir, "."+old.Artifact+".retain")); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	prune(s, &Config{
+		Database:  &database.Connection{Name: "app"},
+		Retention: &retention.Policy{KeepLast: 1},
+	})
+
+	if got := readContent(t, s, old.Artifact); got != "SELECT 1;" {
+		t.Fatalf("unexpected content %q", got)
+	}
+	if _, err := manifest.Read(s, old.Artifact); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,127 @@
+package retention
+
+import (
+	"fmt"
+	"react-web-backup/storage"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration which also accepts day ("7d") and week ("2w")
+// units in the config file.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	v, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func ParseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if n := strings.TrimSuffix(s, suffix); n != s {
+			v, err := strconv.Atoi(n)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %s", s)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+
+	return time.ParseDuration(s)
+}
+
+// Policy decides which backups are kept. A backup is kept as soon as one of
+// the rules keeps it, a policy without any rule keeps everything.
+type Policy struct {
+	KeepLast    int      `yaml:"keep_last,omitempty"`
+	KeepWithin  Duration `yaml:"keep_within,omitempty"`
+	KeepDaily   int      `yaml:"keep_daily,omitempty"`
+	KeepWeekly  int      `yaml:"keep_weekly,omitempty"`
+	KeepMonthly int      `yaml:"keep_monthly,omitempty"`
+	KeepYearly  int      `yaml:"keep_yearly,omitempty"`
+	DryRun      bool     `yaml:"dry_run,omitempty"`
+}
+
+func (p *Policy) IsEmpty() bool {
+	return p.KeepLast == 0 &&
+		p.KeepWithin == 0 &&
+		p.KeepDaily == 0 &&
+		p.KeepWeekly == 0 &&
+		p.KeepMonthly == 0 &&
+		p.KeepYearly == 0
+}
+
+// Backup is a stored backup and the time it was taken, which is kept by its
+// manifest. The time the object was stored changes when it is copied.
+type Backup struct {
+	storage.Object
+	TakenAt time.Time
+}
+
+// Apply splits backups into the ones to keep and the ones to remove, both
+// sorted from the newest to the oldest.
+func (p *Policy) Apply(backups []Backup, now time.Time) (keep []Backup, remove []Backup) {
+	sorted := make([]Backup, len(backups))
+	copy(sorted, backups)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].TakenAt.After(sorted[j].TakenAt)
+	})
+
+	if p.IsEmpty() {
+		return sorted, nil
+	}
+
+	buckets := []struct {
+		count int
+		key   func(t time.Time) string
+		seen  map[string]bool
+	}{
+		{p.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }, map[string]bool{}},
+		{p.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}, map[string]bool{}},
+		{p.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }, map[string]bool{}},
+		{p.KeepYearly, func(t time.Time) string { return t.Format("2006") }, map[string]bool{}},
+	}
+
+	for i, o := range sorted {
+		kept := i < p.KeepLast
+		if p.KeepWithin > 0 && !o.TakenAt.Before(now.Add(-time.Duration(p.KeepWithin))) {
+			kept = true
+		}
+
+		// the newest backup of each period is kept, until enough periods are
+		for b := range buckets {
+			key := buckets[b].key(o.TakenAt)
+			if buckets[b].seen[key] || len(buckets[b].seen) >= buckets[b].count {
+				continue
+			}
+			buckets[b].seen[key] = true
+			kept = true
+		}
+
+		if kept {
+			keep = append(keep, o)
+		} else {
+			remove = append(remove, o)
+		}
+	}
+
+	return keep, remove
+}
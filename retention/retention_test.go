@@ -0,0 +1,82 @@
+package retention
+
+import (
+	"gopkg.in/yaml.v2"
+	"react-web-backup/storage"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Apply(t *testing.T) {
+	now := time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	// one backup a day for the last 400 days
+	// the backups were all copied today in reverse order, only the time they
+	// were taken counts
+	objects := make([]Backup, 0)
+	for i := 0; i < 400; i++ {
+		objects = append(objects, Backup{
+			Object: storage.Object{
+				Name:    now.AddDate(0, 0, -i).Format("20060102"),
+				ModTime: now.Add(-time.Duration(400-i) * time.Second),
+			},
+			TakenAt: now.AddDate(0, 0, -i),
+		})
+	}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		keep   []string
+	}{
+		{"empty", Policy{}, nil},
+		{"last", Policy{KeepLast: 2}, []string{"20220615", "20220614"}},
+		{"within", Policy{KeepWithin: Duration(48 * time.Hour)}, []string{"20220615", "20220614", "20220613"}},
+		{"daily", Policy{KeepDaily: 3}, []string{"20220615", "20220614", "20220613"}},
+		{"weekly", Policy{KeepWeekly: 2}, []string{"20220615", "20220612"}},
+		{"monthly", Policy{KeepMonthly: 3}, []string{"20220615", "20220531", "20220430"}},
+		{"yearly", Policy{KeepYearly: 3}, []string{"20220615", "20211231"}},
+		{
+			"combined",
+			Policy{KeepLast: 1, KeepMonthly: 2, KeepYearly: 2},
+			[]string{"20220615", "20220531", "20211231"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, remove := tt.policy.Apply(objects, now)
+			if len(keep)+len(remove) != len(objects) {
+				t.Fatalf("lost objects: %d kept, %d removed", len(keep), len(remove))
+			}
+			if tt.keep == nil {
+				if len(remove) != 0 {
+					t.Fatalf("empty policy removed %d objects", len(remove))
+				}
+				return
+			}
+
+			names := make([]string, 0)
+			for _, o := range keep {
+				names = append(names, o.Name)
+			}
+			if !reflect.DeepEqual(names, tt.keep) {
+				t.Fatalf("expected %v, got %v", tt.keep, names)
+			}
+		})
+	}
+}
+
+func TestDuration_UnmarshalYAML(t *testing.T) {
+	p := &Policy{}
+	err := yaml.Unmarshal([]byte("keep_within: 2w\nkeep_last: 3\n"), p)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	if time.Duration(p.KeepWithin) != 14*24*time.Hour || p.KeepLast != 3 {
+		t.Fatalf("unexpected policy %+v", p)
+	}
+}
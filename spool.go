@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"react-web-backup/compression"
+	"react-web-backup/database"
+	"react-web-backup/encryption"
+	"react-web-backup/manifest"
+	"react-web-backup/storage"
+	"time"
+)
+
+// spool dumps db to the spool directory along with the manifest m.
+func spool(ctx context.Context, db database.Database, m *manifest.Manifest, compressionConfig *compression.Config, encryptionConfig *encryption.Config, dir string) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		panic(err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, m.Artifact), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	digest := manifest.NewDigest()
+	tables, err := dump(ctx, db, io.MultiWriter(f, digest), compressionConfig, encryptionConfig)
+	if err != nil {
+		panic(err)
+	}
+	if err := f.Sync(); err != nil {
+		panic(err)
+	}
+
+	m.Tables = tables
+	m.Size = digest.Size()
+	m.SHA256 = digest.Sum()
+	m.FinishedAt = time.Now()
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifest.Name(m.Artifact)), content, 0600); err != nil {
+		panic(err)
+	}
+}
+
+// resumeSpooled uploads the backups left in the spool directory by previous
+// runs.
+func resumeSpooled(storages []storage.Storage, c *Config) {
+	if len(c.SpoolDir) == 0 {
+		panic("missing spool_dir config")
+	}
+
+	entries, err := os.ReadDir(c.SpoolDir)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, entry := range entries {
+		if !manifest.IsManifest(entry.Name()) {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(c.SpoolDir, entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		m := &manifest.Manifest{}
+		if err := json.Unmarshal(content, m); err != nil {
+			panic(fmt.Errorf("invalid manifest %s: %w", entry.Name(), err))
+		}
+
+		resume(storages, m, c)
+	}
+}
+
+// resume uploads the spooled backup m to the storages of c it is not in yet.
+// The progress of each upload is kept next to the backup, by key of storage
+// so that reordered or edited configs do not mix them up, and the backup
+// leaves the spool once all uploads are done.
+func resume(storages []storage.Storage, m *manifest.Manifest, c *Config) {
+	artifact := filepath.Join(c.SpoolDir, m.Artifact)
+	progressPaths := make([]string, 0)
+	for _, sc := range storageConfigs(c) {
+		key, err := sc.Key()
+		if err != nil {
+			panic(err)
+		}
+		progressPaths = append(progressPaths, fmt.Sprintf("%s.%s.progress.json", artifact, key))
+	}
+
+	f, err := os.Open(artifact)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	results := make([]storage.Result, 0)
+	failed := 0
+	for i, s := range storages {
+		path, done, err := uploadSpooled(s, f, m, progressPaths[i])
+		if err != nil {
+			fmt.Printf("Backup to %s failed: %v\n", s.Name(), err)
+			failed++
+			continue
+		}
+		if !done {
+			results = append(results, storage.Result{Storage: s, Path: path})
+		}
+	}
+
+	finish(results, m, c)
+
+	if failed > 0 {
+		message := fmt.Sprintf("%s is kept in %s, run the resume action to finish its upload", m.Artifact, c.SpoolDir)
+		if c.StoragePolicy == storage.PolicyAny && failed < len(storages) {
+			fmt.Println(message)
+			return
+		}
+		panic(message)
+	}
+
+	for _, progressPath := range progressPaths {
+		_ = os.Remove(progressPath)
+	}
+	_ = os.Remove(filepath.Join(c.SpoolDir, manifest.Name(m.Artifact)))
+	_ = os.Remove(artifact)
+}
+
+// uploadSpooled uploads f, the spooled artifact of m, to s. done reports an
+// upload completed by a previous run.
+func uploadSpooled(s storage.Storage, f *os.File, m *manifest.Manifest, progressPath string) (path string, done bool, err error) {
+	p := &storage.Progress{}
+	content, err := os.ReadFile(progressPath)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(content, p); err != nil {
+			return "", false, fmt.Errorf("invalid upload progress %s: %w", progressPath, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return "", false, err
+	}
+	if len(p.Path) > 0 {
+		return p.Path, true, nil
+	}
+
+	save := func() error {
+		return saveProgress(progressPath, p)
+	}
+
+	if r, ok := s.(storage.Resumer); ok {
+		path, err = r.UploadResumable(m.Artifact, f, m.Size, p, save)
+	} else {
+		path, err = s.Upload(m.Artifact, io.NewSectionReader(f, 0, m.Size))
+	}
+	if errors.Is(err, storage.ErrExist) {
+		// a previous run uploaded it but stopped before saving its progress
+		path = m.Artifact
+		done, err = checkUploaded(s, m)
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	p.Path = path
+	return path, done, save()
+}
+
+// checkUploaded verifies the artifact of m already in s against m, done
+// reports that its manifest is there too.
+func checkUploaded(s storage.Storage, m *manifest.Manifest) (done bool, err error) {
+	content, err := s.GetContent(m.Artifact)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	digest := manifest.NewDigest()
+	if _, err := io.Copy(digest, content); err != nil {
+		return false, err
+	}
+	if digest.Sum() != m.SHA256 || digest.Size() != m.Size {
+		return false, fmt.Errorf("%s already exists with another content: %w", m.Artifact, storage.ErrExist)
+	}
+
+	_, err = manifest.Read(s, m.Artifact)
+	if errors.Is(err, storage.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// saveProgress replaces the progress file at once, a crash never leaves it
+// half written.
+func saveProgress(path string, p *storage.Progress) error {
+	content, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"react-web-backup/manifest"
+	"react-web-backup/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+// spoolBackup leaves a backup of content in the spool directory of c, as an
+// interrupted backup run does.
+func spoolBackup(t *testing.T, c *Config, content string) *manifest.Manifest {
+	startedAt := time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+	digest := manifest.NewDigest()
+	_, _ = digest.Write([]byte(content))
+	m := &manifest.Manifest{
+		Version:    manifest.Version,
+		Artifact:   backupFileName("app", startedAt),
+		Client:     "pg",
+		Database:   "app",
+		StartedAt:  startedAt,
+		FinishedAt: startedAt,
+		Size:       digest.Size(),
+		SHA256:     digest.Sum(),
+	}
+
+	if err := os.WriteFile(filepath.Join(c.SpoolDir, m.Artifact), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	if err := os.WriteFile(filepath.Join(c.SpoolDir, manifest.Name(m.Artifact)), b, 0600); err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	return m
+}
+
+func newSpoolConfig(t *testing.T) *Config {
+	return &Config{
+		Storages: []*storage.StorageConfig{
+			{Client: "file", Options: storage.Options{StoragePath: t.TempDir()}},
+			{Client: "file", Options: storage.Options{StoragePath: t.TempDir()}},
+		},
+		SpoolDir: t.TempDir(),
+	}
+}
+
+func checkBackup(t *testing.T, s storage.Storage, m *manifest.Manifest, content string) {
+	if got := readContent(t, s, m.Artifact); got != content {
+		t.Fatalf("%s holds %q, want %q", m.Artifact, got, content)
+	}
+	if _, err := manifest.Read(s, m.Artifact); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResume(t *testing.T) {
+	c := newSpoolConfig(t)
+	m := spoolBackup(t, c, "SELECT 1;")
+	first, second := newStorage(c.Storages[0], c), newStorage(c.Storages[1], c)
+
+	// the second storage holds another backup by that name
+	if _, err := second.Upload(m.Artifact, strings.NewReader("SELECT 2;")); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if recovered := panics(func() { resumeSpooled(getStorages(c), c) }); recovered == nil {
+		t.Fatal("expected the upload to the second storage to fail")
+	}
+	checkBackup(t, first, m, "SELECT 1;")
+	if got := readContent(t, second, m.Artifact); got != "SELECT 2;" {
+		t.Fatalf("the conflicting backup was replaced by %q", got)
+	}
+
+	// the progress follows the storage when the configs are reordered
+	key, err := c.Storages[0].Key()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if _, err := os.Stat(filepath.Join(c.SpoolDir, m.Artifact+"."+key+".progress.json")); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if err := second.Delete(m.Artifact); err != nil {
+		t.Fatal(err)
+		return
+	}
+	c.Storages = []*storage.StorageConfig{c.Storages[1], c.Storages[0]}
+	resumeSpooled(getStorages(c), c)
+	checkBackup(t, second, m, "SELECT 1;")
+
+	entries, err := os.ReadDir(c.SpoolDir)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if len(entries) != 0 {
+		t.Fatalf("%d files left in the spool", len(entries))
+	}
+}
+
+func TestResume_Uploaded(t *testing.T) {
+	c := newSpoolConfig(t)
+	m := spoolBackup(t, c, "SELECT 1;")
+	first, second := newStorage(c.Storages[0], c), newStorage(c.Storages[1], c)
+
+	// a previous run uploaded the backup everywhere but stopped before
+	// saving its progress, and before writing the manifest to the second
+	for _, s := range []storage.Storage{first, second} {
+		if _, err := s.Upload(m.Artifact, strings.NewReader("SELECT 1;")); err != nil {
+			t.Fatal(err)
+			return
+		}
+	}
+	if err := manifest.Write(first, m); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	resumeSpooled(getStorages(c), c)
+	checkBackup(t, first, m, "SELECT 1;")
+	checkBackup(t, second, m, "SELECT 1;")
+}
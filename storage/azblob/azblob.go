@@ -0,0 +1,193 @@
+package azblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"react-web-backup/storage"
+	"strings"
+)
+
+const (
+	// blockSize bounds a block blob to 50000 blocks of 16 MiB, about 780 GiB.
+	blockSize   = 16 * 1024 * 1024
+	concurrency = 4
+)
+
+func init() {
+	storage.RegisterStorage(&AzBlob{})
+}
+
+type AzBlob struct {
+	client    *azblob.Client
+	url       string
+	container string
+	prefix    string
+	// immutableDays sets an immutability policy on uploads, the container
+	// must have version-level immutability enabled.
+	immutableDays int
+	immutableMode blob.ImmutabilityPolicySetting
+}
+
+func (a *AzBlob) Name() string {
+	return "azblob"
+}
+
+func (a *AzBlob) Schemes() []string {
+	return []string{"azblob"}
+}
+
+// ParseURL reads azblob://container/prefix?account=name&endpoint=http://127.0.0.1:10000/name,
+// the account key or SAS token come from the options.
+func (a *AzBlob) ParseURL(u *url.URL) (storage.Options, error) {
+	return storage.Options{
+		Container: u.Host,
+		Prefix:    u.Path,
+		Account:   u.Query().Get("account"),
+		Endpoint:  u.Query().Get("endpoint"),
+	}, nil
+}
+
+func (a *AzBlob) Init(c storage.Options) error {
+	if err := c.Check("azblob", "account", "account_key", "sas_token", "container", "prefix", "endpoint", "immutable_days", "immutable_mode"); err != nil {
+		return err
+	}
+	if len(c.Container) == 0 {
+		return errors.New("missing container for azblob storage")
+	}
+
+	immutableDays, immutableMode, err := c.Immutability()
+	if err != nil {
+		return err
+	}
+
+	endpoint := c.Endpoint
+	if len(endpoint) == 0 {
+		if len(c.Account) == 0 {
+			return errors.New("missing account or endpoint for azblob storage")
+		}
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", c.Account)
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/") + "/"
+
+	var client *azblob.Client
+	switch {
+	case len(c.AccountKey) > 0:
+		credential, credentialErr := azblob.NewSharedKeyCredential(c.Account, c.AccountKey)
+		if credentialErr != nil {
+			return credentialErr
+		}
+		client, err = azblob.NewClientWithSharedKeyCredential(endpoint, credential, nil)
+	case len(c.SASToken) > 0:
+		client, err = azblob.NewClientWithNoCredential(endpoint+"?"+strings.TrimPrefix(c.SASToken, "?"), nil)
+	default:
+		return errors.New("missing account_key or sas_token for azblob storage")
+	}
+	if err != nil {
+		return err
+	}
+
+	a.client = client
+	a.url = endpoint
+	a.container = c.Container
+	a.prefix = strings.Trim(c.Prefix, "/")
+	a.immutableDays = immutableDays
+	a.immutableMode = blob.ImmutabilityPolicySettingUnlocked
+	if immutableMode == storage.ImmutableCompliance {
+		a.immutableMode = blob.ImmutabilityPolicySettingLocked
+	}
+
+	return nil
+}
+
+// Upload streams content in parallel blocks, immutable uploads stage their
+// blocks one by one instead, as only the commit of a block list can set the
+// immutability policy together with the content.
+func (a *AzBlob) Upload(name string, content io.Reader) (string, error) {
+	if a.immutableDays > 0 {
+		return a.uploadBlocks(name, content)
+	}
+
+	key := a.key(name)
+	_, err := a.client.UploadStream(context.Background(), a.container, key, content, &azblob.UploadStreamOptions{
+		BlockSize:   blockSize,
+		Concurrency: concurrency,
+	})
+	if err != nil {
+		return "", wrapError(name, err)
+	}
+
+	return a.url + a.container + "/" + key, nil
+}
+
+func (a *AzBlob) GetContent(name string) (io.ReadCloser, error) {
+	response, err := a.client.DownloadStream(context.Background(), a.container, a.key(name), nil)
+	if err != nil {
+		return nil, wrapError(name, err)
+	}
+
+	return response.Body, nil
+}
+
+func (a *AzBlob) List(prefix string) ([]storage.Object, error) {
+	root := ""
+	if len(a.prefix) > 0 {
+		root = a.prefix + "/"
+	}
+	blobPrefix := root + prefix
+
+	objects := make([]storage.Object, 0)
+	pager := a.client.NewListBlobsFlatPager(a.container, &azblob.ListBlobsFlatOptions{Prefix: &blobPrefix})
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Segment.BlobItems {
+			object := storage.Object{Name: strings.TrimPrefix(*item.Name, root)}
+			if item.Properties != nil {
+				if item.Properties.ContentLength != nil {
+					object.Size = *item.Properties.ContentLength
+				}
+				if item.Properties.LastModified != nil {
+					object.ModTime = *item.Properties.LastModified
+				}
+			}
+			objects = append(objects, object)
+		}
+	}
+
+	return objects, nil
+}
+
+func (a *AzBlob) Delete(name string) error {
+	_, err := a.client.DeleteBlob(context.Background(), a.container, a.key(name), nil)
+	return wrapError(name, err)
+}
+
+func (a *AzBlob) key(name string) string {
+	return path.Join(a.prefix, name)
+}
+
+func wrapError(name string, err error) error {
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("%s: %w", name, storage.ErrNotExist)
+	}
+	if bloberror.HasCode(err, bloberror.BlobImmutableDueToPolicy, bloberror.ImmutabilityPolicyDeleteOnLockedPolicy) {
+		return fmt.Errorf("%s: %w", name, storage.ErrImmutable)
+	}
+	// the pipeline already retried these, a later attempt may still succeed
+	var responseErr *azcore.ResponseError
+	if errors.As(err, &responseErr) && (responseErr.StatusCode >= http.StatusInternalServerError || responseErr.StatusCode == http.StatusTooManyRequests) {
+		return storage.Retriable(err)
+	}
+	return err
+}
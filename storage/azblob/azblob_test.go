@@ -0,0 +1,139 @@
+package azblob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"io"
+	"net/http"
+	"os"
+	"react-web-backup/storage"
+	"react-web-backup/storage/storagetest"
+	"testing"
+)
+
+// Azurite's well-known development account.
+const (
+	azuriteAccount = "devstoreaccount1"
+	azuriteKey     = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+// newTestAzBlob connects to Azurite, e.g.
+// AZURITE_ENDPOINT=http://127.0.0.1:10000/devstoreaccount1
+func newTestAzBlob(t *testing.T) *AzBlob {
+	endpoint := os.Getenv("AZURITE_ENDPOINT")
+	if len(endpoint) == 0 {
+		t.Skip("AZURITE_ENDPOINT is not set")
+	}
+
+	a := &AzBlob{}
+	err := a.Init(storage.Options{
+		Endpoint:   endpoint,
+		Account:    azuriteAccount,
+		AccountKey: azuriteKey,
+		Container:  "backups",
+		Prefix:     "nightly",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	_, err = a.client.CreateContainer(context.Background(), "backups", nil)
+	if err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
+		t.Fatal(err)
+		return nil
+	}
+
+	return a
+}
+
+func TestAzBlob(t *testing.T) {
+	storagetest.TestStorage(t, newTestAzBlob(t), true)
+}
+
+func TestAzBlob_UploadResumable(t *testing.T) {
+	a := newTestAzBlob(t)
+
+	content := bytes.Repeat([]byte("INSERT INTO users (id) VALUES (1);\n"), blockSize/16)
+	p := &storage.Progress{}
+
+	// the first run is interrupted once the first block is staged
+	_, err := a.UploadResumable("resumed.sql", bytes.NewReader(content), int64(len(content)), p, func() error {
+		if len(p.Parts) == 1 {
+			return errors.New("interrupted")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected the upload to be interrupted")
+	}
+
+	if _, err := a.UploadResumable("resumed.sql", bytes.NewReader(content), int64(len(content)), p, func() error { return nil }); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	r, err := a.GetContent("resumed.sql")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	b, err := io.ReadAll(r)
+	_ = r.Close()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if !bytes.Equal(b, content) {
+		t.Fatal("resumed upload does not match the content")
+	}
+	_ = a.Delete("resumed.sql")
+}
+
+func TestWrapError(t *testing.T) {
+	codes := map[bloberror.Code]error{
+		bloberror.BlobNotFound:                           storage.ErrNotExist,
+		bloberror.BlobImmutableDueToPolicy:               storage.ErrImmutable,
+		bloberror.ImmutabilityPolicyDeleteOnLockedPolicy: storage.ErrImmutable,
+	}
+	for code, want := range codes {
+		if err := wrapError("backup.sql", &azcore.ResponseError{ErrorCode: string(code)}); !errors.Is(err, want) {
+			t.Fatalf("%s: expected %v, got %v", code, want, err)
+		}
+	}
+
+	if err := wrapError("backup.sql", &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}); !storage.IsRetriable(err) {
+		t.Fatalf("expected a retriable error, got %v", err)
+	}
+}
+
+func TestAzBlob_UploadBlocks(t *testing.T) {
+	a := newTestAzBlob(t)
+
+	// more than one block, the last one partial
+	content := bytes.Repeat([]byte("INSERT INTO users (id) VALUES (1);\n"), blockSize/16)
+	if _, err := a.uploadBlocks("blocks.sql", bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+		return
+	}
+	defer func() {
+		_ = a.Delete("blocks.sql")
+	}()
+
+	r, err := a.GetContent("blocks.sql")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	b, err := io.ReadAll(r)
+	_ = r.Close()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if !bytes.Equal(b, content) {
+		t.Fatal("uploaded blocks do not match the content")
+	}
+}
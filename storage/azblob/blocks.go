@@ -0,0 +1,139 @@
+package azblob
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"io"
+	"react-web-backup/storage"
+	"time"
+)
+
+const maxBlocks = 50000
+
+// UploadResumable stages the blocks of content one by one and commits them
+// once all are staged. Uncommitted blocks are kept by Azure for a week.
+func (a *AzBlob) UploadResumable(name string, content io.ReaderAt, size int64, p *storage.Progress, save func() error) (string, error) {
+	ctx := context.Background()
+	key := a.key(name)
+	client := a.client.ServiceClient().NewContainerClient(a.container).NewBlockBlobClient(key)
+
+	if p.PartSize > 0 {
+		staged, err := stagedBlocks(ctx, client)
+		if err != nil {
+			return "", err
+		}
+		// keep the recorded blocks up to the first one which expired
+		for i, part := range p.Parts {
+			if !staged[blockID(part.Number)] {
+				p.Parts = p.Parts[:i]
+				break
+			}
+		}
+	}
+
+	if p.PartSize == 0 {
+		p.PartSize = storage.PartSize(size, blockSize, maxBlocks)
+		if err := save(); err != nil {
+			return "", err
+		}
+	}
+
+	for number := len(p.Parts) + 1; number <= storage.PartCount(size, p.PartSize); number++ {
+		offset := int64(number-1) * p.PartSize
+		length := min(p.PartSize, size-offset)
+		body := streaming.NopCloser(io.NewSectionReader(content, offset, length))
+		if _, err := client.StageBlock(ctx, blockID(number), body, nil); err != nil {
+			return "", wrapError(name, err)
+		}
+
+		p.Parts = append(p.Parts, storage.Part{Number: number})
+		if err := save(); err != nil {
+			return "", err
+		}
+	}
+
+	ids := make([]string, 0)
+	for _, part := range p.Parts {
+		ids = append(ids, blockID(part.Number))
+	}
+	if err := a.commitBlocks(ctx, client, ids); err != nil {
+		return "", wrapError(name, err)
+	}
+
+	return a.url + a.container + "/" + key, nil
+}
+
+// uploadBlocks stages content block by block then commits them.
+func (a *AzBlob) uploadBlocks(name string, content io.Reader) (string, error) {
+	ctx := context.Background()
+	key := a.key(name)
+	client := a.client.ServiceClient().NewContainerClient(a.container).NewBlockBlobClient(key)
+
+	ids := make([]string, 0)
+	buf := make([]byte, blockSize)
+	for number := 1; ; number++ {
+		n, err := io.ReadFull(content, buf)
+		if n > 0 {
+			if number > maxBlocks {
+				return "", fmt.Errorf("%s exceeds %d blocks", name, maxBlocks)
+			}
+			if _, err := client.StageBlock(ctx, blockID(number), streaming.NopCloser(bytes.NewReader(buf[:n])), nil); err != nil {
+				return "", wrapError(name, err)
+			}
+			ids = append(ids, blockID(number))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := a.commitBlocks(ctx, client, ids); err != nil {
+		return "", wrapError(name, err)
+	}
+	return a.url + a.container + "/" + key, nil
+}
+
+// commitBlocks commits the staged blocks ids as the content of the blob,
+// immutable from the start when configured.
+func (a *AzBlob) commitBlocks(ctx context.Context, client *blockblob.Client, ids []string) error {
+	options := &blockblob.CommitBlockListOptions{}
+	if a.immutableDays > 0 {
+		until := storage.RetainUntil(time.Now(), a.immutableDays)
+		options.ImmutabilityPolicyMode = &a.immutableMode
+		options.ImmutabilityPolicyExpiryTime = &until
+	}
+	_, err := client.CommitBlockList(ctx, ids, options)
+	return err
+}
+
+func stagedBlocks(ctx context.Context, client *blockblob.Client) (map[string]bool, error) {
+	staged := make(map[string]bool)
+	response, err := client.GetBlockList(ctx, blockblob.BlockListTypeUncommitted, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return staged, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, block := range response.UncommittedBlocks {
+		if block.Name != nil {
+			staged[*block.Name] = true
+		}
+	}
+	return staged, nil
+}
+
+// blockID returns the id of block number, ids of a blob must have the same
+// length.
+func blockID(number int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", number)))
+}
@@ -2,25 +2,66 @@ package file
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"react-web-backup/storage"
+	"strings"
+	"time"
 )
 
 func init() {
 	storage.RegisterStorage(&File{})
 }
 
+// tempExtension marks the hidden files of uploads in progress.
+const tempExtension = ".tmp"
+
 type File struct {
-	storagePath string
+	storagePath   string
+	overwrite     bool
+	immutableDays int
 }
 
 func (f *File) Name() string {
 	return "file"
 }
 
+func (f *File) Schemes() []string {
+	return []string{"file"}
+}
+
+// ParseURL reads file:///var/backups, or file:backups relative to the working
+// directory.
+func (f *File) ParseURL(u *url.URL) (storage.Options, error) {
+	if len(u.Host) > 0 && u.Host != "localhost" {
+		return storage.Options{}, fmt.Errorf("unexpected host %s", u.Host)
+	}
+
+	storagePath := u.Path
+	if len(u.Opaque) > 0 {
+		storagePath = u.Opaque
+	}
+	overwrite, err := storage.QueryBool(u, "overwrite")
+	return storage.Options{StoragePath: storagePath, Overwrite: overwrite}, err
+}
+
 func (f *File) Init(c storage.Options) error {
+	if err := c.Check("file", "storage_path", "overwrite", "immutable_days"); err != nil {
+		return err
+	}
+	immutableDays, _, err := c.Immutability()
+	if err != nil {
+		return err
+	}
+
 	f.storagePath = c.StoragePath
+	f.overwrite = c.Overwrite
+	f.immutableDays = immutableDays
 	if !path.IsAbs(f.storagePath) {
 		cwd, err := os.Getwd()
 		if err != nil {
@@ -29,7 +70,7 @@ func (f *File) Init(c storage.Options) error {
 		f.storagePath = path.Join(cwd, f.storagePath)
 	}
 
-	_, err := os.Stat(f.storagePath)
+	_, err = os.Stat(f.storagePath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			err = os.MkdirAll(f.storagePath, os.ModePerm)
@@ -43,25 +84,165 @@ func (f *File) Init(c storage.Options) error {
 	return nil
 }
 
-func (f *File) Upload(name string, content string) (string, error) {
-	filePath := path.Join(f.storagePath, name)
-	file, err := os.Create(filePath)
+// Upload writes content to a temporary file which is synced then renamed
+// into place, so a crash never leaves a truncated backup behind.
+func (f *File) Upload(name string, content io.Reader) (string, error) {
+	filePath, err := f.resolve(name)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return "", err
+	}
+
+	if !f.overwrite {
+		if _, err := os.Stat(filePath); err == nil {
+			return "", fmt.Errorf("%s: %w", name, storage.ErrExist)
+		}
+	}
+	if err := checkMutable(name, filePath); err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*"+tempExtension)
 	if err != nil {
 		return "", err
 	}
 	defer func() {
-		_ = file.Close()
+		// no-op once the file is renamed
+		_ = os.Remove(file.Name())
 	}()
-	_, err = file.WriteString(content)
-	return filePath, err
-}
 
-func (f *File) GetContent(name string) (string, error) {
-	filePath := path.Join(f.storagePath, name)
-	content, err := os.ReadFile(filePath)
+	_, err = io.Copy(file, content)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		return "", err
 	}
 
-	return string(content), nil
+	if f.immutableDays > 0 {
+		if err := os.Chmod(file.Name(), 0444); err != nil {
+			return "", err
+		}
+		// recorded first, a crash never leaves the backup unprotected
+		if err := retain(filePath, storage.RetainUntil(time.Now(), f.immutableDays)); err != nil {
+			return "", err
+		}
+	}
+
+	if err := f.rename(file.Name(), filePath); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return "", fmt.Errorf("%s: %w", name, storage.ErrExist)
+		}
+		return "", err
+	}
+
+	return filePath, syncDir(filepath.Dir(filePath))
+}
+
+func (f *File) GetContent(name string) (io.ReadCloser, error) {
+	filePath, err := f.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filePath)
+}
+
+func (f *File) List(prefix string) ([]storage.Object, error) {
+	objects := make([]storage.Object, 0)
+	err := filepath.WalkDir(f.storagePath, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		name, err := filepath.Rel(f.storagePath, filePath)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if !strings.HasPrefix(name, prefix) || isTemp(d.Name()) || isRetain(d.Name()) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, storage.Object{
+			Name:    name,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+
+	return objects, err
+}
+
+func (f *File) Delete(name string) error {
+	filePath, err := f.resolve(name)
+	if err != nil {
+		return err
+	}
+	if err := checkMutable(name, filePath); err != nil {
+		return err
+	}
+
+	if err := os.Remove(filePath); err != nil {
+		return err
+	}
+	if err := os.Remove(retainPath(filePath)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// resolve returns the path of name, which must stay inside the storage path.
+func (f *File) resolve(name string) (string, error) {
+	filePath := filepath.Join(f.storagePath, filepath.FromSlash(name))
+	rel, err := filepath.Rel(f.storagePath, filePath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid backup name %s", name)
+	}
+	return filePath, nil
+}
+
+// rename moves the temporary file to filePath, without replacing an existing
+// file unless overwriting is allowed.
+func (f *File) rename(tmp string, filePath string) error {
+	if f.overwrite {
+		return os.Rename(tmp, filePath)
+	}
+
+	// a hard link fails when filePath exists, unlike a rename
+	err := os.Link(tmp, filePath)
+	if err == nil || errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	// the file system does not support hard links
+	if _, err := os.Stat(filePath); err == nil {
+		return fs.ErrExist
+	}
+	return os.Rename(tmp, filePath)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = d.Close()
+	}()
+	return d.Sync()
+}
+
+func isTemp(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, tempExtension)
 }
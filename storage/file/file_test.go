@@ -1,7 +1,172 @@
 package file
 
-import "testing"
+import (
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"react-web-backup/storage"
+	"react-web-backup/storage/storagetest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
 
 func TestFile(t *testing.T) {
+	f := &File{}
+	err := f.Init(storage.Options{StoragePath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
 
+	storagetest.TestStorage(t, f, false)
+
+	// options of other clients are mistakes
+	if err := (&File{}).Init(storage.Options{StoragePath: t.TempDir(), Bucket: "backups"}); err == nil {
+		t.Fatal("expected an error for the bucket option")
+	}
+}
+
+func TestFile_Upload(t *testing.T) {
+	dir := t.TempDir()
+	f := &File{}
+	err := f.Init(storage.Options{StoragePath: dir})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	if _, err := f.Upload("backup.sql", strings.NewReader("SELECT 1;")); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if _, err := f.Upload("backup.sql", strings.NewReader("SELECT 2;")); !errors.Is(err, storage.ErrExist) {
+		t.Fatalf("expected ErrExist, got %v", err)
+	}
+
+	// an interrupted upload leaves neither a backup nor a visible file behind
+	_, err = f.Upload("broken.sql", io.MultiReader(strings.NewReader("SELECT"), iotest.ErrReader(errors.New("connection reset"))))
+	if err == nil {
+		t.Fatal("expected upload error")
+	}
+	objects, err := f.List("")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if len(objects) != 1 || objects[0].Name != "backup.sql" {
+		t.Fatalf("unexpected objects %+v", objects)
+	}
+
+	for _, name := range []string{"../backup.sql", "a/../../backup.sql", "..", ""} {
+		if _, err := f.Upload(name, strings.NewReader("SELECT 1;")); err == nil {
+			t.Fatalf("expected %q to be rejected", name)
+		}
+		if _, err := f.GetContent(name); err == nil {
+			t.Fatalf("expected %q to be rejected", name)
+		}
+	}
+
+	f.overwrite = true
+	if _, err := f.Upload("backup.sql", strings.NewReader("SELECT 2;")); err != nil {
+		t.Fatal(err)
+		return
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "backup.sql"))
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if string(b) != "SELECT 2;" {
+		t.Fatalf("unexpected content %q", b)
+	}
+}
+
+func TestFile_ParseURL(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]storage.Options{
+		"file://" + dir + "?overwrite=true": {StoragePath: dir, Overwrite: true},
+		"file:backups":                      {StoragePath: "backups"},
+		"file://localhost/var/backups":      {StoragePath: "/var/backups"},
+	}
+
+	for rawURL, want := range tests {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		got, err := (&File{}).ParseURL(u)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if got != want {
+			t.Fatalf("%s has options %+v, want %+v", rawURL, got, want)
+		}
+	}
+
+	if _, err := (&File{}).ParseURL(&url.URL{Scheme: "file", Host: "remote", Path: "/backups"}); err == nil {
+		t.Fatal("expected an error for a remote host")
+	}
+}
+
+func TestFile_Immutable(t *testing.T) {
+	dir := t.TempDir()
+	f := &File{}
+	err := f.Init(storage.Options{StoragePath: dir, Overwrite: true, ImmutableDays: 30})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	if _, err := f.Upload("backup.sql", strings.NewReader("SELECT 1;")); err != nil {
+		t.Fatal(err)
+		return
+	}
+	info, err := os.Stat(filepath.Join(dir, "backup.sql"))
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if info.Mode().Perm()&0222 != 0 {
+		t.Fatalf("backup is writable, mode %s", info.Mode())
+	}
+
+	if _, err := f.Upload("backup.sql", strings.NewReader("SELECT 2;")); !errors.Is(err, storage.ErrImmutable) {
+		t.Fatalf("expected ErrImmutable on overwrite, got %v", err)
+	}
+	if err := f.Delete("backup.sql"); !errors.Is(err, storage.ErrImmutable) {
+		t.Fatalf("expected ErrImmutable on delete, got %v", err)
+	}
+
+	objects, err := f.List("")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if len(objects) != 1 || objects[0].Name != "backup.sql" {
+		t.Fatalf("unexpected objects %+v", objects)
+	}
+
+	// once the retention expired the backup can go
+	if err := retain(filepath.Join(dir, "backup.sql"), time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if err := f.Delete("backup.sql"); err != nil {
+		t.Fatal(err)
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if len(entries) != 0 {
+		t.Fatalf("%d files left after delete", len(entries))
+	}
 }
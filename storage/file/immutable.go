@@ -0,0 +1,80 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"react-web-backup/storage"
+	"strings"
+	"time"
+)
+
+// retainExtension marks the hidden files recording until when the backup
+// next to them is immutable. Like the read-only mode of the backup, they
+// guard against mistakes and careless tools, a user owning the storage path
+// can still remove both.
+const retainExtension = ".retain"
+
+func retainPath(filePath string) string {
+	return filepath.Join(filepath.Dir(filePath), "."+filepath.Base(filePath)+retainExtension)
+}
+
+// retainedUntil returns until when the backup at filePath is immutable, zero
+// when it never was.
+func retainedUntil(filePath string) (time.Time, error) {
+	b, err := os.ReadFile(retainPath(filePath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Parse(time.RFC3339, strings.TrimSpace(string(b)))
+}
+
+// checkMutable fails while the backup name at filePath is immutable.
+func checkMutable(name string, filePath string) error {
+	until, err := retainedUntil(filePath)
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(until) {
+		return fmt.Errorf("%s until %s: %w", name, until.Format(time.RFC3339), storage.ErrImmutable)
+	}
+	return nil
+}
+
+// retain records that the backup at filePath is immutable until, replacing
+// any previous record at once.
+func retain(filePath string, until time.Time) error {
+	file, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*"+tempExtension)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	_, err = file.WriteString(until.Format(time.RFC3339) + "\n")
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(file.Name(), 0444); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), retainPath(filePath))
+}
+
+func isRetain(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, retainExtension)
+}
@@ -0,0 +1,137 @@
+package ftp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"react-web-backup/storage"
+	"react-web-backup/storage/storagetest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFTP(t *testing.T) {
+	for _, mode := range []string{"", TLSExplicit} {
+		t.Run("tls="+mode, func(t *testing.T) {
+			port, caFile := startServer(t, mode)
+
+			f := &FTP{}
+			err := f.Init(storage.Options{
+				Host:        "127.0.0.1",
+				Port:        port,
+				User:        "backup",
+				Password:    "secret",
+				StoragePath: "/nightly/app",
+				TLS:         mode,
+				CAFile:      caFile,
+			})
+			if err != nil {
+				t.Fatal(err)
+				return
+			}
+
+			if _, err := f.Upload("../backup.sql", strings.NewReader("SELECT 1;")); err == nil {
+				t.Fatal("expected name outside the storage path to be rejected")
+			}
+
+			storagetest.TestStorage(t, f, false)
+		})
+	}
+}
+
+// startServer runs an in-process FTP server backed by a temporary directory
+// and returns its port and, for TLS modes, the file of its certificate.
+func startServer(t *testing.T, mode string) (int, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	_ = ln.Close()
+
+	driver, err := file.NewDriver(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &server.Options{
+		Driver:   driver,
+		Auth:     &server.SimpleAuth{Name: "backup", Password: "secret"},
+		Perm:     server.NewSimplePerm("backup", "backup"),
+		Hostname: "127.0.0.1",
+		Port:     port,
+		Logger:   &server.DiscardLogger{},
+	}
+
+	caFile := ""
+	if mode != "" {
+		cert, ca := certificate(t)
+		caFile = path.Join(t.TempDir(), "ca.pem")
+		if err := os.WriteFile(caFile, ca, 0600); err != nil {
+			t.Fatal(err)
+		}
+		opts.TLS = true
+		opts.ExplicitFTPS = mode == TLSExplicit
+		opts.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	s, err := server.NewServer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = s.ListenAndServe()
+	}()
+	t.Cleanup(func() {
+		_ = s.Shutdown()
+	})
+
+	// wait for the server to listen
+	for i := 0; i < 50; i++ {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err == nil {
+			_ = conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return port, caFile
+}
+
+func certificate(t *testing.T) (tls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,181 @@
+package gcs
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	storage2 "react-web-backup/storage"
+	"strings"
+	"time"
+)
+
+func init() {
+	storage2.RegisterStorage(&GCS{})
+}
+
+type GCS struct {
+	bucket *storage.BucketHandle
+	name   string
+	prefix string
+	// immutableDays sets a retention on uploads, the bucket must have object
+	// retention enabled.
+	immutableDays int
+	immutableMode string
+}
+
+func (g *GCS) Name() string {
+	return "gcs"
+}
+
+func (g *GCS) Schemes() []string {
+	return []string{"gs", "gcs"}
+}
+
+// ParseURL reads gs://bucket/prefix?credentials_file=key.json&endpoint=http://127.0.0.1:4443.
+func (g *GCS) ParseURL(u *url.URL) (storage2.Options, error) {
+	return storage2.Options{
+		Bucket:          u.Host,
+		Prefix:          u.Path,
+		CredentialsFile: u.Query().Get("credentials_file"),
+		Endpoint:        u.Query().Get("endpoint"),
+	}, nil
+}
+
+func (g *GCS) Init(c storage2.Options) error {
+	if err := c.Check("gcs", "bucket", "prefix", "endpoint", "credentials", "credentials_file", "immutable_days", "immutable_mode"); err != nil {
+		return err
+	}
+	if len(c.Bucket) == 0 {
+		return errors.New("missing bucket for gcs storage")
+	}
+
+	immutableDays, immutableMode, err := c.Immutability()
+	if err != nil {
+		return err
+	}
+
+	options := make([]option.ClientOption, 0)
+	switch {
+	case len(c.Credentials) > 0:
+		options = append(options, option.WithAuthCredentialsJSON(option.ServiceAccount, []byte(c.Credentials)))
+	case len(c.CredentialsFile) > 0:
+		options = append(options, option.WithAuthCredentialsFile(option.ServiceAccount, c.CredentialsFile))
+	case len(c.Endpoint) > 0:
+		// emulators such as fake-gcs-server do not authenticate
+		options = append(options, option.WithoutAuthentication())
+	}
+	if len(c.Endpoint) > 0 {
+		// emulators only serve reads through the JSON API
+		options = append(options, option.WithEndpoint(strings.TrimSuffix(c.Endpoint, "/")+"/storage/v1/"), storage.WithJSONReads())
+	}
+
+	client, err := storage.NewClient(context.Background(), options...)
+	if err != nil {
+		return err
+	}
+
+	g.bucket = client.Bucket(c.Bucket)
+	g.name = c.Bucket
+	g.prefix = strings.Trim(c.Prefix, "/")
+	g.immutableDays = immutableDays
+	g.immutableMode = "Unlocked"
+	if immutableMode == storage2.ImmutableCompliance {
+		g.immutableMode = "Locked"
+	}
+
+	return nil
+}
+
+func (g *GCS) Upload(name string, content io.Reader) (string, error) {
+	key := g.key(name)
+	w := g.bucket.Object(key).NewWriter(context.Background())
+	if g.immutableDays > 0 {
+		w.Retention = &storage.ObjectRetention{
+			Mode:        g.immutableMode,
+			RetainUntil: storage2.RetainUntil(time.Now(), g.immutableDays),
+		}
+	}
+	if _, err := io.Copy(w, content); err != nil {
+		_ = w.CloseWithError(err)
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", wrapError(name, err)
+	}
+
+	return fmt.Sprintf("gs://%s/%s", g.name, key), nil
+}
+
+func (g *GCS) GetContent(name string) (io.ReadCloser, error) {
+	r, err := g.bucket.Object(g.key(name)).NewReader(context.Background())
+	return r, wrapError(name, err)
+}
+
+func (g *GCS) List(prefix string) ([]storage2.Object, error) {
+	root := ""
+	if len(g.prefix) > 0 {
+		root = g.prefix + "/"
+	}
+
+	objects := make([]storage2.Object, 0)
+	it := g.bucket.Objects(context.Background(), &storage.Query{Prefix: root + prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, storage2.Object{
+			Name:    strings.TrimPrefix(attrs.Name, root),
+			Size:    attrs.Size,
+			ModTime: attrs.Updated,
+		})
+	}
+
+	return objects, nil
+}
+
+func (g *GCS) Delete(name string) error {
+	return wrapError(name, g.bucket.Object(g.key(name)).Delete(context.Background()))
+}
+
+func (g *GCS) key(name string) string {
+	return path.Join(g.prefix, name)
+}
+
+func wrapError(name string, err error) error {
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("%s: %w", name, storage2.ErrNotExist)
+	}
+	if isRetained(err) {
+		return fmt.Errorf("%s: %w", name, storage2.ErrImmutable)
+	}
+	return err
+}
+
+// isRetained reports whether err refuses to delete or overwrite an object
+// under a retention policy, an object retention or a hold.
+func isRetained(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		return false
+	}
+
+	for _, item := range apiErr.Errors {
+		if item.Reason == "retentionPolicyNotMet" || item.Reason == "objectUnderActiveHold" {
+			return true
+		}
+	}
+	message := strings.ToLower(apiErr.Message)
+	return strings.Contains(message, "retention") || strings.Contains(message, "hold")
+}
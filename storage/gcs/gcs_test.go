@@ -0,0 +1,55 @@
+package gcs
+
+import (
+	"errors"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"google.golang.org/api/googleapi"
+	"net/http"
+	"react-web-backup/storage"
+	"react-web-backup/storage/storagetest"
+	"testing"
+)
+
+func TestGCS(t *testing.T) {
+	server, err := fakestorage.NewServerWithOptions(fakestorage.Options{
+		Scheme: "http",
+		Host:   "127.0.0.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	defer server.Stop()
+	server.CreateBucketWithOpts(fakestorage.CreateBucketOpts{Name: "backups"})
+
+	g := &GCS{}
+	err = g.Init(storage.Options{
+		Bucket:   "backups",
+		Prefix:   "nightly",
+		Endpoint: server.URL(),
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	storagetest.TestStorage(t, g, true)
+}
+
+func TestWrapError(t *testing.T) {
+	retained := []error{
+		&googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "retentionPolicyNotMet"}}},
+		&googleapi.Error{Code: http.StatusForbidden, Message: "Object 'nightly/backup.sql' is subject to object retention and cannot be deleted or overwritten."},
+		&googleapi.Error{Code: http.StatusForbidden, Message: "Object 'nightly/backup.sql' is under active Event-Based hold and cannot be deleted, overwritten or archived until hold is removed."},
+	}
+	for _, err := range retained {
+		if !errors.Is(wrapError("backup.sql", err), storage.ErrImmutable) {
+			t.Fatalf("expected ErrImmutable for %v", err)
+		}
+	}
+
+	denied := &googleapi.Error{Code: http.StatusForbidden, Message: "Access denied."}
+	if errors.Is(wrapError("backup.sql", denied), storage.ErrImmutable) {
+		t.Fatalf("a plain access denied is not immutable")
+	}
+}
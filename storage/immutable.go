@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// ImmutableGovernance lets privileged credentials lift the protection.
+	ImmutableGovernance = "governance"
+	// ImmutableCompliance lets nobody lift the protection until it expires.
+	ImmutableCompliance = "compliance"
+)
+
+// ErrImmutable is wrapped by the errors of Upload and Delete when the object
+// is protected until a later date.
+var ErrImmutable = errors.New("backup is immutable")
+
+// Immutability returns for how many days uploads are protected against
+// overwrite and deletion, zero when they are not, and the protection mode.
+func (o Options) Immutability() (int, string, error) {
+	if o.ImmutableDays < 0 {
+		return 0, "", fmt.Errorf("invalid immutable days %d", o.ImmutableDays)
+	}
+
+	switch o.ImmutableMode {
+	case "":
+		return o.ImmutableDays, ImmutableGovernance, nil
+	case ImmutableGovernance, ImmutableCompliance:
+		return o.ImmutableDays, o.ImmutableMode, nil
+	}
+
+	return 0, "", fmt.Errorf("unknown immutable mode %s", o.ImmutableMode)
+}
+
+// RetainUntil returns the end of the protection of an object uploaded at now
+// for days.
+func RetainUntil(now time.Time, days int) time.Time {
+	return now.AddDate(0, 0, days).UTC()
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// PolicyAll fails an upload to several storages as soon as one fails.
+	PolicyAll = "all"
+	// PolicyAny only fails an upload to several storages when all fail.
+	PolicyAny = "any"
+)
+
+// Result is the outcome of the upload to one of the storages of UploadAll.
+type Result struct {
+	Storage Storage
+	Path    string
+	Err     error
+}
+
+type fanoutTarget struct {
+	w    *io.PipeWriter
+	done chan struct{}
+	// failed is only touched by the copying side, Result only by the upload
+	// until done is closed.
+	failed error
+	Result
+}
+
+// UploadAll streams content once to every storage. Following policy, a
+// storage failing either aborts the other uploads or is left behind while
+// the others carry on. The results are in the order of storages.
+func UploadAll(storages []Storage, name string, content io.Reader, policy string) ([]Result, error) {
+	if policy == "" {
+		policy = PolicyAll
+	}
+	if policy != PolicyAll && policy != PolicyAny {
+		return nil, fmt.Errorf("unknown storage policy %s", policy)
+	}
+
+	targets := make([]*fanoutTarget, 0)
+	for _, s := range storages {
+		r, w := io.Pipe()
+		t := &fanoutTarget{w: w, done: make(chan struct{}), Result: Result{Storage: s}}
+		targets = append(targets, t)
+		go func() {
+			defer close(t.done)
+			t.Path, t.Err = t.Storage.Upload(name, r)
+			// unblock the writer if the upload stopped reading early
+			_ = r.CloseWithError(errors.New("upload stopped reading"))
+		}()
+	}
+
+	err := fanout(targets, content, policy)
+	for _, t := range targets {
+		_ = t.w.CloseWithError(err)
+	}
+
+	results := make([]Result, 0)
+	failed := 0
+	for _, t := range targets {
+		<-t.done
+		result := t.Result
+		if result.Err == nil {
+			result.Err = t.failed
+		}
+		if result.Err == nil {
+			result.Err = err
+		}
+		if result.Err != nil {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if err != nil {
+		return results, err
+	}
+	if failed > 0 && (policy == PolicyAll || failed == len(results)) {
+		return results, fmt.Errorf("upload of %s failed on %d of %d storages", name, failed, len(results))
+	}
+
+	return results, nil
+}
+
+// fanout copies content to the targets still accepting it.
+func fanout(targets []*fanoutTarget, content io.Reader, policy string) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := content.Read(buf)
+		if n > 0 {
+			alive := 0
+			for _, t := range targets {
+				if t.failed != nil {
+					continue
+				}
+				if _, werr := t.w.Write(buf[:n]); werr != nil {
+					<-t.done
+					t.failed = t.Err
+					if t.failed == nil {
+						t.failed = werr
+					}
+					if policy == PolicyAll {
+						return fmt.Errorf("upload to %s failed: %w", t.Storage.Name(), t.failed)
+					}
+					continue
+				}
+				alive++
+			}
+			if alive == 0 {
+				return errors.New("upload failed on every storage")
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+type memStorage struct {
+	content bytes.Buffer
+	failAt  int
+}
+
+func (m *memStorage) Name() string                  { return "mem" }
+func (m *memStorage) Init(options Options) error    { return nil }
+func (m *memStorage) Delete(name string) error      { return nil }
+func (m *memStorage) List(string) ([]Object, error) { return nil, nil }
+
+func (m *memStorage) GetContent(name string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(m.content.Bytes())), nil
+}
+
+func (m *memStorage) Upload(name string, content io.Reader) (string, error) {
+	if m.failAt > 0 {
+		_, _ = io.CopyN(&m.content, content, int64(m.failAt))
+		return "", errors.New("connection reset")
+	}
+	_, err := io.Copy(&m.content, content)
+	return name, err
+}
+
+func TestUploadAll(t *testing.T) {
+	content := strings.Repeat("INSERT INTO users (id) VALUES (1);\n", 10000)
+
+	tests := []struct {
+		name    string
+		policy  string
+		failing bool
+		wantErr bool
+	}{
+		{"all succeed", PolicyAll, false, false},
+		{"all with failure", PolicyAll, true, true},
+		{"any with failure", PolicyAny, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			second := &memStorage{}
+			if tt.failing {
+				second.failAt = 1000
+			}
+			storages := []Storage{&memStorage{}, second, &memStorage{}}
+
+			results, err := UploadAll(storages, "backup.sql", strings.NewReader(content), tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(results) != len(storages) {
+				t.Fatalf("expected %d results, got %d", len(storages), len(results))
+			}
+			if tt.failing && results[1].Err == nil {
+				t.Fatal("expected the failing storage to report an error")
+			}
+
+			if tt.wantErr {
+				return
+			}
+			for i, r := range results {
+				if i == 1 && tt.failing {
+					continue
+				}
+				if r.Err != nil || r.Path != "backup.sql" {
+					t.Fatalf("unexpected result %+v", r)
+				}
+				if storages[i].(*memStorage).content.String() != content {
+					t.Fatalf("storage %d got %d bytes", i, storages[i].(*memStorage).content.Len())
+				}
+			}
+		})
+	}
+
+	_, err := UploadAll([]Storage{&memStorage{failAt: 1}}, "backup.sql", strings.NewReader(content), PolicyAny)
+	if err == nil {
+		t.Fatal("expected error when every storage fails")
+	}
+}
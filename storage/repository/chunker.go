@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+)
+
+// Chunk boundaries are content defined with a gear rolling hash (as in
+// FastCDC): a boundary follows every byte where the hash has its low bits
+// clear, so an insert only changes the chunks around it and the rest of the
+// dump still deduplicates against the previous backups.
+const (
+	minChunkSize = 512 * 1024
+	maxChunkSize = 8 * 1024 * 1024
+	// chunkMask gives chunks of about 1 MiB past minChunkSize.
+	chunkMask = 1<<20 - 1
+)
+
+// gear must never change, chunks stored with another table would no longer
+// match.
+var gear = func() [256]uint64 {
+	var table [256]uint64
+	for i := range table {
+		sum := sha256.Sum256([]byte{byte(i)})
+		table[i] = binary.BigEndian.Uint64(sum[:8])
+	}
+	return table
+}()
+
+type chunker struct {
+	r          io.Reader
+	buf        []byte
+	start, end int
+	eof        bool
+}
+
+func newChunker(r io.Reader) *chunker {
+	return &chunker{r: r, buf: make([]byte, maxChunkSize)}
+}
+
+// Next returns the next chunk of the stream, which is only valid until the
+// following call, or io.EOF at the end of the stream.
+func (c *chunker) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+
+	data := c.buf[c.start:c.end]
+	size := len(data)
+	if size > minChunkSize {
+		var h uint64
+		for i := minChunkSize; i < len(data); i++ {
+			h = h<<1 + gear[data[i]]
+			if h&chunkMask == 0 {
+				size = i + 1
+				break
+			}
+		}
+	}
+
+	c.start += size
+	return data[:size], nil
+}
+
+// fill reads until the buffer holds a maximum sized chunk or the stream ends.
+func (c *chunker) fill() error {
+	if c.eof || c.end-c.start == len(c.buf) {
+		return nil
+	}
+
+	c.end = copy(c.buf, c.buf[c.start:c.end])
+	c.start = 0
+	n, err := io.ReadFull(c.r, c.buf[c.end:])
+	c.end += n
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.eof = true
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,472 @@
+// Package repository stores backups deduplicated: every artifact is split into
+// content defined chunks kept once by their hash under chunks/, and the
+// artifact itself only holds the index of its chunks.
+package repository
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"react-web-backup/compression"
+	"react-web-backup/encryption"
+	"react-web-backup/storage"
+	"strings"
+	"time"
+)
+
+const (
+	IndexVersion = 2
+	chunkPrefix  = "chunks/"
+	lockPrefix   = "locks/"
+	// gracePeriod keeps unreferenced chunks for a while after their upload, in
+	// case the listing of the storage lags behind. The chunks of a backup
+	// still being uploaded, new or reused, are protected by its lock instead.
+	gracePeriod = 24 * time.Hour
+
+	uploadLock  = "upload"
+	collectLock = "collect"
+	// uploadTimeout and collectTimeout tell after how long the lock of an
+	// interrupted upload or collect is ignored.
+	uploadTimeout  = gracePeriod
+	collectTimeout = time.Hour
+	// releasedExtension marks a lock the storage does not let us delete.
+	releasedExtension = ".released"
+)
+
+// lockPoll is how often an upload checks whether a collect is over.
+var lockPoll = 10 * time.Second
+
+// Index lists the chunks of an artifact. Version 1 identifies chunks by the
+// SHA-256 of their content, version 2 by its HMAC-SHA-256 keyed with
+// encryption.Config.ChunkKey when the chunk is encrypted, so that chunk names
+// do not reveal the content.
+type Index struct {
+	Version int     `json:"version"`
+	Size    int64   `json:"size"`
+	Chunks  []Chunk `json:"chunks"`
+}
+
+// Chunk is a piece of an artifact, ID is the hash of its content and Object
+// the name it is stored under, encoded as its extensions tell.
+type Chunk struct {
+	ID     string `json:"id"`
+	Size   int64  `json:"size"`
+	Object string `json:"object"`
+}
+
+// Repository wraps a storage to keep the backups uploaded to it deduplicated.
+// Chunks are compressed and encrypted one by one, as whole artifacts would no
+// longer deduplicate. Chunk names are the hash of the plain content, keyed
+// when encrypted. On an immutable storage a chunk is only protected for the
+// days following its first upload, not for as long as the latest backup using
+// it.
+type Repository struct {
+	storage.Storage
+	compression *compression.Config
+	encryption  *encryption.Config
+	// chunks holds the names of the stored chunks, listed on each upload.
+	chunks map[string]bool
+	// key is the chunk key of encryption, derived on first use.
+	key []byte
+}
+
+func New(s storage.Storage, compressionConfig *compression.Config, encryptionConfig *encryption.Config) *Repository {
+	return &Repository{Storage: s, compression: compressionConfig, encryption: encryptionConfig}
+}
+
+// Upload stores content under name, holding a lock which keeps a concurrent
+// Collect from deleting the chunks it reuses.
+func (r *Repository) Upload(name string, content io.Reader) (string, error) {
+	lock, err := r.lock(uploadLock)
+	if err != nil {
+		return "", err
+	}
+	filePath, err := r.upload(name, content)
+	if unlockErr := r.unlock(lock); err == nil {
+		err = unlockErr
+	}
+	return filePath, err
+}
+
+func (r *Repository) upload(name string, content io.Reader) (string, error) {
+	if err := r.waitCollect(); err != nil {
+		return "", err
+	}
+	// a collect may have deleted chunks since the last upload
+	r.chunks = nil
+	if err := r.loadChunks(); err != nil {
+		return "", err
+	}
+
+	index := &Index{Version: IndexVersion, Chunks: make([]Chunk, 0)}
+	c := newChunker(content)
+	for {
+		data, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		chunk, err := r.putChunk(data)
+		if err != nil {
+			return "", err
+		}
+		index.Chunks = append(index.Chunks, chunk)
+		index.Size += chunk.Size
+	}
+
+	b, err := json.Marshal(index)
+	if err != nil {
+		return "", err
+	}
+	return r.Storage.Upload(name, bytes.NewReader(b))
+}
+
+func (r *Repository) loadChunks() error {
+	if r.chunks != nil {
+		return nil
+	}
+
+	objects, err := r.Storage.List(chunkPrefix)
+	if err != nil {
+		return err
+	}
+	r.chunks = make(map[string]bool)
+	for _, o := range objects {
+		r.chunks[o.Name] = true
+	}
+	return nil
+}
+
+func (r *Repository) putChunk(data []byte) (Chunk, error) {
+	h, err := r.newHash(IndexVersion, r.encryption != nil && r.encryption.Type != encryption.None)
+	if err != nil {
+		return Chunk{}, err
+	}
+	h.Write(data)
+	id := hex.EncodeToString(h.Sum(nil))
+	chunk := Chunk{ID: id, Size: int64(len(data)), Object: r.chunkName(id)}
+	if r.chunks[chunk.Object] {
+		return chunk, nil
+	}
+
+	buf := &bytes.Buffer{}
+	ew, err := encryption.NewWriter(buf, r.encryption)
+	if err != nil {
+		return chunk, err
+	}
+	cw, err := compression.NewWriter(ew, r.compression)
+	if err != nil {
+		return chunk, err
+	}
+	if _, err := cw.Write(data); err != nil {
+		return chunk, err
+	}
+	if err := cw.Close(); err != nil {
+		return chunk, err
+	}
+	if err := ew.Close(); err != nil {
+		return chunk, err
+	}
+
+	_, err = r.Storage.Upload(chunk.Object, buf)
+	if err != nil && !errors.Is(err, storage.ErrExist) && !errors.Is(err, storage.ErrImmutable) {
+		return chunk, err
+	}
+	r.chunks[chunk.Object] = true
+	return chunk, nil
+}
+
+// newHash returns the hash identifying the chunks of an index of version,
+// keyed when they are encrypted.
+func (r *Repository) newHash(version int, encrypted bool) (hash.Hash, error) {
+	if version < 2 || !encrypted {
+		return sha256.New(), nil
+	}
+
+	if r.key == nil {
+		key, err := r.encryption.ChunkKey()
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return nil, errors.New("chunks are encrypted but encryption is not configured")
+		}
+		r.key = key
+	}
+	return hmac.New(sha256.New, r.key), nil
+}
+
+// chunkName is the object of chunk id encoded with the current settings, a
+// chunk stored with other settings is uploaded again.
+func (r *Repository) chunkName(id string) string {
+	codec := compression.None
+	if r.compression != nil {
+		codec = r.compression.Codec
+	}
+	method := encryption.None
+	if r.encryption != nil {
+		method = r.encryption.Type
+	}
+	return chunkPrefix + id[:2] + "/" + id + compression.Extension(codec) + encryption.Extension(method)
+}
+
+func (r *Repository) readIndex(name string) (*Index, error) {
+	content, err := r.Storage.GetContent(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	index := &Index{}
+	if err := json.NewDecoder(content).Decode(index); err != nil {
+		return nil, fmt.Errorf("cannot read index %s: %w", name, err)
+	}
+	if index.Version < 1 || index.Version > IndexVersion {
+		return nil, fmt.Errorf("unsupported index version %d of %s", index.Version, name)
+	}
+	return index, nil
+}
+
+// GetContent reassembles the artifact name from its chunks, checking each of
+// them against its hash.
+func (r *Repository) GetContent(name string) (io.ReadCloser, error) {
+	index, err := r.readIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	return &reader{repository: r, version: index.Version, chunks: index.Chunks}, nil
+}
+
+// List returns the artifacts of the repository with their full size, chunks
+// and locks are left out.
+func (r *Repository) List(prefix string) ([]storage.Object, error) {
+	objects, err := r.Storage.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := make([]storage.Object, 0)
+	for _, o := range objects {
+		if strings.HasPrefix(o.Name, chunkPrefix) || strings.HasPrefix(o.Name, lockPrefix) {
+			continue
+		}
+		index, err := r.readIndex(o.Name)
+		if err != nil {
+			return nil, err
+		}
+		o.Size = index.Size
+		artifacts = append(artifacts, o)
+	}
+	return artifacts, nil
+}
+
+// Collect deletes the chunks no artifact refers to anymore. It leaves them
+// while an upload runs, whose index does not refer to the chunks it reuses
+// yet, and uploads wait for a running Collect in turn.
+func (r *Repository) Collect() error {
+	lock, err := r.lock(collectLock)
+	if err != nil {
+		return err
+	}
+	err = r.collect()
+	if unlockErr := r.unlock(lock); err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+func (r *Repository) collect() error {
+	objects, err := r.Storage.List("")
+	if err != nil {
+		return err
+	}
+	if len(activeLocks(objects, uploadLock, uploadTimeout)) > 0 {
+		return nil
+	}
+
+	referenced := make(map[string]bool)
+	for _, o := range objects {
+		if strings.HasPrefix(o.Name, chunkPrefix) || strings.HasPrefix(o.Name, lockPrefix) {
+			continue
+		}
+		index, err := r.readIndex(o.Name)
+		if err != nil {
+			return err
+		}
+		for _, chunk := range index.Chunks {
+			referenced[chunk.Object] = true
+		}
+	}
+
+	for _, o := range objects {
+		// old locks are left by interrupted runs or immutable storages
+		isLock := strings.HasPrefix(o.Name, lockPrefix)
+		if !isLock && !strings.HasPrefix(o.Name, chunkPrefix) || referenced[o.Name] || time.Since(o.ModTime) < gracePeriod {
+			continue
+		}
+		err := r.Storage.Delete(o.Name)
+		if errors.Is(err, storage.ErrImmutable) {
+			continue
+		}
+		if err != nil && !errors.Is(err, storage.ErrNotExist) {
+			return err
+		}
+		delete(r.chunks, o.Name)
+	}
+	return nil
+}
+
+// lock announces an upload or a collect to the other runs sharing the storage,
+// it returns the name of the lock.
+func (r *Repository) lock(kind string) (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	name := lockPrefix + kind + "-" + hex.EncodeToString(id)
+	_, err := r.Storage.Upload(name, strings.NewReader(time.Now().UTC().Format(time.RFC3339)+"\n"))
+	return name, err
+}
+
+// unlock deletes the lock name, or marks it released when the storage keeps
+// it.
+func (r *Repository) unlock(name string) error {
+	err := r.Storage.Delete(name)
+	if errors.Is(err, storage.ErrImmutable) {
+		_, err = r.Storage.Upload(name+releasedExtension, strings.NewReader(time.Now().UTC().Format(time.RFC3339)+"\n"))
+	}
+	return err
+}
+
+// waitCollect waits until no collect runs, the chunks listed meanwhile could
+// be deleted before the index refers to them.
+func (r *Repository) waitCollect() error {
+	for {
+		objects, err := r.Storage.List(lockPrefix)
+		if err != nil {
+			return err
+		}
+		if len(activeLocks(objects, collectLock, collectTimeout)) == 0 {
+			return nil
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// activeLocks returns the locks of kind among objects which are neither
+// released nor older than timeout.
+func activeLocks(objects []storage.Object, kind string, timeout time.Duration) []string {
+	released := make(map[string]bool)
+	for _, o := range objects {
+		if strings.HasSuffix(o.Name, releasedExtension) {
+			released[strings.TrimSuffix(o.Name, releasedExtension)] = true
+		}
+	}
+
+	locks := make([]string, 0)
+	for _, o := range objects {
+		if !strings.HasPrefix(o.Name, lockPrefix+kind+"-") || strings.HasSuffix(o.Name, releasedExtension) {
+			continue
+		}
+		if !released[o.Name] && time.Since(o.ModTime) < timeout {
+			locks = append(locks, o.Name)
+		}
+	}
+	return locks
+}
+
+type reader struct {
+	repository *Repository
+	version    int
+	chunks     []Chunk
+	current    io.ReadCloser
+	decoded    io.ReadCloser
+	hash       hash.Hash
+	chunk      Chunk
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for {
+		if r.decoded == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			if err := r.open(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.decoded.Read(p)
+		r.hash.Write(p[:n])
+		if err == io.EOF {
+			if err := r.check(); err != nil {
+				return n, err
+			}
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (r *reader) open() error {
+	r.chunk, r.chunks = r.chunks[0], r.chunks[1:]
+	content, err := r.repository.Storage.GetContent(r.chunk.Object)
+	if err != nil {
+		return err
+	}
+	r.current = content
+
+	method := encryption.FromName(r.chunk.Object)
+	dr, err := encryption.NewReader(content, method, r.repository.encryption)
+	if err != nil {
+		return err
+	}
+	codec := compression.FromName(strings.TrimSuffix(r.chunk.Object, encryption.Extension(method)))
+	r.decoded, err = compression.NewReader(dr, codec)
+	if err != nil {
+		return err
+	}
+	r.hash, err = r.repository.newHash(r.version, method != encryption.None)
+	return err
+}
+
+// check closes the current chunk and verifies it was read whole and intact.
+func (r *reader) check() error {
+	err := r.close()
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(r.hash.Sum(nil)) != r.chunk.ID {
+		return fmt.Errorf("chunk %s is corrupted", r.chunk.Object)
+	}
+	return nil
+}
+
+func (r *reader) close() error {
+	if r.decoded == nil {
+		return nil
+	}
+	_ = r.decoded.Close()
+	err := r.current.Close()
+	r.decoded, r.current = nil, nil
+	return err
+}
+
+func (r *reader) Close() error {
+	return r.close()
+}
@@ -0,0 +1,390 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"react-web-backup/compression"
+	"react-web-backup/encryption"
+	"react-web-backup/storage"
+	_ "react-web-backup/storage/file"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChunker(t *testing.T) {
+	data := make([]byte, 20*1024*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	chunks := split(t, data)
+	total := 0
+	for i, chunk := range chunks {
+		if len(chunk) > maxChunkSize || len(chunk) < minChunkSize && i < len(chunks)-1 {
+			t.Fatalf("chunk %d has size %d", i, len(chunk))
+		}
+		total += len(chunk)
+	}
+	if total != len(data) {
+		t.Fatalf("chunks hold %d bytes, want %d", total, len(data))
+	}
+
+	// an insert at the start only changes the chunks around it
+	shifted := split(t, append([]byte("INSERT INTO users (id) VALUES (1);\n"), data...))
+	known := make(map[string]bool)
+	for _, chunk := range chunks {
+		known[string(chunk)] = true
+	}
+	changed := 0
+	for _, chunk := range shifted {
+		if !known[string(chunk)] {
+			changed++
+		}
+	}
+	if changed > 1 {
+		t.Fatalf("%d of %d chunks changed", changed, len(shifted))
+	}
+}
+
+func split(t *testing.T, data []byte) [][]byte {
+	chunks := make([][]byte, 0)
+	c := newChunker(bytes.NewReader(data))
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatal(err)
+			return nil
+		}
+		chunks = append(chunks, bytes.Clone(chunk))
+	}
+}
+
+func TestRepository(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, bytes.Repeat([]byte("k"), 32), 0600); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	dir := t.TempDir()
+	s, err := storage.GetStorage(&storage.StorageConfig{Client: "file", Options: storage.Options{StoragePath: dir}})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	r := New(s, &compression.Config{Codec: compression.Zstd}, &encryption.Config{Type: encryption.AESGCM, KeyFile: keyFile})
+
+	random := make([]byte, 4*1024*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+	first := strings.Repeat("INSERT INTO users (id) VALUES (1);\n", 100000) + string(random)
+	second := "INSERT INTO users (id) VALUES (0);\n" + first
+
+	if _, err := r.Upload("1-db.sql", strings.NewReader(first)); err != nil {
+		t.Fatal(err)
+		return
+	}
+	before := countChunks(t, dir)
+	if _, err := r.Upload("2-db.sql", strings.NewReader(second)); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if added := countChunks(t, dir) - before; added > 1 {
+		t.Fatalf("second backup added %d chunks", added)
+	}
+
+	for name, want := range map[string]string{"1-db.sql": first, "2-db.sql": second} {
+		content, err := r.GetContent(name)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		b, err := io.ReadAll(content)
+		_ = content.Close()
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if string(b) != want {
+			t.Fatalf("%s does not match the uploaded content", name)
+		}
+	}
+
+	objects, err := r.List("")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if len(objects) != 2 || objects[0].Size != int64(len(first)) || objects[1].Size != int64(len(second)) {
+		t.Fatalf("unexpected objects %+v", objects)
+	}
+
+	if err := r.Delete("1-db.sql"); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if err := r.Delete("2-db.sql"); err != nil {
+		t.Fatal(err)
+		return
+	}
+	// chunks within the grace period are kept
+	if err := r.Collect(); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if countChunks(t, dir) == 0 {
+		t.Fatal("recent chunks were collected")
+	}
+
+	ageChunks(t, dir)
+	if err := r.Collect(); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if n := countChunks(t, dir); n != 0 {
+		t.Fatalf("%d chunks left after collect", n)
+	}
+}
+
+func TestRepository_ChunkNames(t *testing.T) {
+	s, err := storage.GetStorage(&storage.StorageConfig{Client: "file", Options: storage.Options{StoragePath: t.TempDir()}})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	r := New(s, nil, &encryption.Config{Type: encryption.AESGCM, Passphrase: "secret"})
+
+	content := "SELECT 1;"
+	if _, err := r.Upload("1-db.sql", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+		return
+	}
+	index, err := r.readIndex("1-db.sql")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	sum := sha256.Sum256([]byte(content))
+	if len(index.Chunks) != 1 || strings.Contains(index.Chunks[0].Object, hex.EncodeToString(sum[:])) {
+		t.Fatalf("chunks %+v are named by the hash of their content", index.Chunks)
+	}
+
+	// another key neither finds nor verifies the chunks
+	other := New(s, nil, &encryption.Config{Type: encryption.AESGCM, Passphrase: "other"})
+	if _, err := other.Upload("2-db.sql", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+		return
+	}
+	otherIndex, err := other.readIndex("2-db.sql")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if otherIndex.Chunks[0].Object == index.Chunks[0].Object {
+		t.Fatal("different keys name chunks alike")
+	}
+
+	for name, r := range map[string]*Repository{"1-db.sql": r, "2-db.sql": other} {
+		b, err := readAll(r, name)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if b != content {
+			t.Fatalf("%s does not match the uploaded content", name)
+		}
+	}
+}
+
+func TestRepository_Locks(t *testing.T) {
+	dir := t.TempDir()
+	s, err := storage.GetStorage(&storage.StorageConfig{Client: "file", Options: storage.Options{StoragePath: dir}})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	r := New(s, nil, nil)
+
+	if _, err := r.Upload("1-db.sql", strings.NewReader("SELECT 1;")); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if err := r.Delete("1-db.sql"); err != nil {
+		t.Fatal(err)
+		return
+	}
+	ageChunks(t, dir)
+
+	// an upload in progress may reuse the unreferenced chunk
+	lock, err := r.lock(uploadLock)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if err := r.Collect(); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if countChunks(t, dir) != 1 {
+		t.Fatal("chunks were collected during an upload")
+	}
+	if err := r.unlock(lock); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if err := r.Collect(); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if n := countChunks(t, dir); n != 0 {
+		t.Fatalf("%d chunks left after collect", n)
+	}
+
+	// an upload waits for a running collect
+	poll := lockPoll
+	lockPoll = time.Millisecond
+	defer func() {
+		lockPoll = poll
+	}()
+	lock, err = r.lock(collectLock)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	done := make(chan error)
+	go func() {
+		_, err := r.Upload("2-db.sql", strings.NewReader("SELECT 2;"))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("upload did not wait for the collect: %v", err)
+		return
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := r.unlock(lock); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	objects, err := s.List(lockPrefix)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if len(objects) != 0 {
+		t.Fatalf("locks left behind %+v", objects)
+	}
+}
+
+func TestRepository_ImmutableLocks(t *testing.T) {
+	s, err := storage.GetStorage(&storage.StorageConfig{Client: "file", Options: storage.Options{StoragePath: t.TempDir(), ImmutableDays: 1}})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	r := New(s, nil, nil)
+
+	if _, err := r.Upload("1-db.sql", strings.NewReader("SELECT 1;")); err != nil {
+		t.Fatal(err)
+		return
+	}
+	objects, err := s.List(lockPrefix)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if len(objects) != 2 || len(activeLocks(objects, uploadLock, uploadTimeout)) != 0 {
+		t.Fatalf("upload lock was not released %+v", objects)
+	}
+}
+
+func TestRepository_Corrupted(t *testing.T) {
+	dir := t.TempDir()
+	s, err := storage.GetStorage(&storage.StorageConfig{Client: "file", Options: storage.Options{StoragePath: dir, Overwrite: true}})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	r := New(s, nil, nil)
+
+	if _, err := r.Upload("1-db.sql", strings.NewReader("SELECT 1;")); err != nil {
+		t.Fatal(err)
+		return
+	}
+	index, err := r.readIndex("1-db.sql")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if _, err := s.Upload(index.Chunks[0].Object, strings.NewReader("SELECT 2;")); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	content, err := r.GetContent("1-db.sql")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+	if _, err := io.ReadAll(content); err == nil {
+		t.Fatal("expected an error reading a corrupted chunk")
+	}
+}
+
+func readAll(r *Repository, name string) (string, error) {
+	content, err := r.GetContent(name)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+	b, err := io.ReadAll(content)
+	return string(b), err
+}
+
+// ageChunks makes the chunks in dir older than the grace period.
+func ageChunks(t *testing.T, dir string) {
+	old := time.Now().Add(-2 * gracePeriod)
+	err := filepath.WalkDir(filepath.Join(dir, "chunks"), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return os.Chtimes(p, old, old)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countChunks(t *testing.T, dir string) int {
+	n := 0
+	err := filepath.WalkDir(filepath.Join(dir, "chunks"), func(p string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return filepath.SkipAll
+		}
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
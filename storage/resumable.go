@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"io"
+)
+
+// Progress records the parts of a resumable upload confirmed by the storage.
+type Progress struct {
+	UploadID string `json:"upload_id,omitempty"`
+	PartSize int64  `json:"part_size,omitempty"`
+	Parts    []Part `json:"parts,omitempty"`
+	// Path is set once the upload is complete.
+	Path string `json:"path,omitempty"`
+}
+
+type Part struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag,omitempty"`
+}
+
+// Resumer is implemented by the storages which upload in parts and can resume
+// an interrupted upload from its last confirmed part.
+type Resumer interface {
+	// UploadResumable uploads the size bytes of content to name, skipping the
+	// parts already recorded in progress. The storage calls save every time it
+	// updates progress, which is reset when the upload cannot be resumed.
+	UploadResumable(name string, content io.ReaderAt, size int64, progress *Progress, save func() error) (string, error)
+}
+
+// PartSize returns the size of the parts of an upload of size bytes, at least
+// minSize and large enough to stay within maxParts.
+func PartSize(size int64, minSize int64, maxParts int64) int64 {
+	partSize := (size + maxParts - 1) / maxParts
+	return max(partSize, minSize)
+}
+
+// PartCount returns the number of parts of partSize bytes in an upload of
+// size bytes, an empty upload still has one part.
+func PartCount(size int64, partSize int64) int {
+	return int(max((size+partSize-1)/partSize, 1))
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultAttempts = 5
+	defaultDelay    = time.Second
+	defaultMaxDelay = time.Minute
+)
+
+// RetryConfig retries the storage operations failing with a retriable error,
+// waiting an exponential backoff with jitter between attempts. An upload is
+// only retried when its content can be read again: a streamed backup cannot,
+// one kept in the spool directory can.
+type RetryConfig struct {
+	// Attempts includes the first one.
+	Attempts int           `yaml:"attempts,omitempty"`
+	Delay    time.Duration `yaml:"delay,omitempty"`
+	MaxDelay time.Duration `yaml:"max_delay,omitempty"`
+}
+
+// RetriableError marks an error after which the failed operation may succeed
+// when attempted again.
+type RetriableError struct {
+	Err error
+}
+
+func (e *RetriableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetriableError) Unwrap() error {
+	return e.Err
+}
+
+// Retriable marks err as retriable.
+func Retriable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetriableError{Err: err}
+}
+
+// IsRetriable reports whether err was marked retriable by a storage or is a
+// network failure.
+func IsRetriable(err error) bool {
+	var retriable *RetriableError
+	if errors.As(err, &retriable) {
+		return true
+	}
+	if err == nil || errors.Is(err, ErrNotExist) || errors.Is(err, ErrExist) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+type retrying struct {
+	Storage
+	config RetryConfig
+	// sleep is replaced in tests
+	sleep func(time.Duration)
+}
+
+func newRetrying(s Storage, c RetryConfig) *retrying {
+	if c.Attempts == 0 {
+		c.Attempts = defaultAttempts
+	}
+	if c.Delay == 0 {
+		c.Delay = defaultDelay
+	}
+	if c.MaxDelay == 0 {
+		c.MaxDelay = defaultMaxDelay
+	}
+	return &retrying{Storage: s, config: c, sleep: time.Sleep}
+}
+
+// retry calls f until it succeeds, fails with an error which is not
+// retriable, or runs out of attempts. rewind is called before each retry and
+// gives up the retries when it fails.
+func (r *retrying) retry(f func() error, rewind func() error) error {
+	delay := r.config.Delay
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= r.config.Attempts || !IsRetriable(err) {
+			return err
+		}
+		if rewind != nil && rewind() != nil {
+			return err
+		}
+
+		// equal jitter, half of the delay is random
+		r.sleep(delay/2 + rand.N(delay/2+1))
+		delay = min(delay*2, r.config.MaxDelay)
+	}
+}
+
+func (r *retrying) Upload(name string, content io.Reader) (string, error) {
+	counter := &countingReader{r: content}
+	seeker, seekable := content.(io.Seeker)
+	var start int64
+	if seekable {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			seekable = false
+		}
+	}
+
+	var path string
+	err := r.retry(func() error {
+		var err error
+		path, err = r.Storage.Upload(name, counter)
+		return err
+	}, func() error {
+		if counter.n == 0 {
+			return nil
+		}
+		if !seekable {
+			return errors.New("content cannot be read again")
+		}
+		counter.n = 0
+		_, err := seeker.Seek(start, io.SeekStart)
+		return err
+	})
+	return path, err
+}
+
+// UploadResumable retries the upload from its last confirmed part.
+func (r *retrying) UploadResumable(name string, content io.ReaderAt, size int64, progress *Progress, save func() error) (string, error) {
+	var path string
+	err := r.retry(func() error {
+		var err error
+		path, err = uploadResumable(r.Storage, name, content, size, progress, save)
+		return err
+	}, nil)
+	return path, err
+}
+
+func (r *retrying) GetContent(name string) (io.ReadCloser, error) {
+	var content io.ReadCloser
+	err := r.retry(func() error {
+		var err error
+		content, err = r.Storage.GetContent(name)
+		return err
+	}, nil)
+	return content, err
+}
+
+func (r *retrying) List(prefix string) ([]Object, error) {
+	var objects []Object
+	err := r.retry(func() error {
+		var err error
+		objects, err = r.Storage.List(prefix)
+		return err
+	}, nil)
+	return objects, err
+}
+
+func (r *retrying) Delete(name string) error {
+	return r.retry(func() error {
+		return r.Storage.Delete(name)
+	}, nil)
+}
+
+// uploadResumable uploads content to s in parts when s supports it, at once
+// otherwise.
+func uploadResumable(s Storage, name string, content io.ReaderAt, size int64, progress *Progress, save func() error) (string, error) {
+	if resumer, ok := s.(Resumer); ok {
+		return resumer.UploadResumable(name, content, size, progress, save)
+	}
+	return s.Upload(name, io.NewSectionReader(content, 0, size))
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyStorage fails the first uploads after reading part of their content.
+type flakyStorage struct {
+	memStorage
+	failures int
+	err      error
+	attempts int
+}
+
+func (f *flakyStorage) Upload(name string, content io.Reader) (string, error) {
+	f.attempts++
+	if f.attempts <= f.failures {
+		_, _ = io.CopyN(io.Discard, content, 4)
+		return "", f.err
+	}
+	f.content.Reset()
+	return f.memStorage.Upload(name, content)
+}
+
+func TestRetrying_Upload(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      io.Reader
+		err          error
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"seekable", strings.NewReader("SELECT 1;"), Retriable(errors.New("503")), false, 3},
+		{"streamed", io.MultiReader(strings.NewReader("SELECT 1;")), Retriable(errors.New("503")), true, 1},
+		{"not retriable", strings.NewReader("SELECT 1;"), errors.New("403"), true, 1},
+		{"not exist", strings.NewReader("SELECT 1;"), ErrNotExist, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &flakyStorage{failures: 2, err: tt.err}
+			delays := make([]time.Duration, 0)
+			r := newRetrying(s, RetryConfig{Attempts: 3, Delay: time.Second})
+			r.sleep = func(d time.Duration) {
+				delays = append(delays, d)
+			}
+
+			_, err := r.Upload("backup.sql", tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if s.attempts != tt.wantAttempts {
+				t.Fatalf("%d attempts, want %d", s.attempts, tt.wantAttempts)
+			}
+			if !tt.wantErr && s.content.String() != "SELECT 1;" {
+				t.Fatalf("unexpected content %q", s.content.String())
+			}
+			for i, d := range delays {
+				base := time.Second << i
+				if d < base/2 || d > base {
+					t.Fatalf("delay %d is %s", i, d)
+				}
+			}
+		})
+	}
+}
+
+func TestIsRetriable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("denied"), false},
+		{io.ErrUnexpectedEOF, true},
+		{Retriable(ErrNotExist), true},
+		{ErrNotExist, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetriable(tt.err); got != tt.want {
+			t.Errorf("IsRetriable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"io"
+	"react-web-backup/storage"
+)
+
+const maxParts = 10000
+
+func (s *S3) UploadResumable(name string, content io.ReaderAt, size int64, p *storage.Progress, save func() error) (string, error) {
+	ctx := context.Background()
+	core := minio.Core{Client: s.client}
+	key := s.key(name)
+
+	if len(p.UploadID) > 0 {
+		// the upload is gone once aborted or expired by a lifecycle rule
+		_, err := core.ListObjectParts(ctx, s.bucket, key, p.UploadID, 0, 1)
+		if minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+			*p = storage.Progress{}
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	if len(p.UploadID) == 0 {
+		uploadID, err := core.NewMultipartUpload(ctx, s.bucket, key, s.putOptions())
+		if err != nil {
+			return "", err
+		}
+		p.UploadID = uploadID
+		p.PartSize = storage.PartSize(size, partSize, maxParts)
+		if err := save(); err != nil {
+			return "", err
+		}
+	}
+
+	for number := len(p.Parts) + 1; number <= storage.PartCount(size, p.PartSize); number++ {
+		offset := int64(number-1) * p.PartSize
+		length := min(p.PartSize, size-offset)
+		options := minio.PutObjectPartOptions{}
+		if s.immutableDays > 0 {
+			// object lock requires the MD5 of each part
+			h := md5.New()
+			if _, err := io.Copy(h, io.NewSectionReader(content, offset, length)); err != nil {
+				return "", err
+			}
+			options.Md5Base64 = base64.StdEncoding.EncodeToString(h.Sum(nil))
+		}
+		part, err := core.PutObjectPart(ctx, s.bucket, key, p.UploadID, number, io.NewSectionReader(content, offset, length), length, options)
+		if err != nil {
+			return "", s.wrapError(name, err)
+		}
+
+		p.Parts = append(p.Parts, storage.Part{Number: number, ETag: part.ETag})
+		if err := save(); err != nil {
+			return "", err
+		}
+	}
+
+	parts := make([]minio.CompletePart, 0)
+	for _, part := range p.Parts {
+		parts = append(parts, minio.CompletePart{PartNumber: part.Number, ETag: part.ETag})
+	}
+	if _, err := core.CompleteMultipartUpload(ctx, s.bucket, key, p.UploadID, parts, minio.PutObjectOptions{}); err != nil {
+		return "", s.wrapError(name, err)
+	}
+
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key), nil
+}
@@ -0,0 +1,239 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"react-web-backup/storage"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEndpoint = "s3.amazonaws.com"
+	// partSize bounds the memory used while streaming a dump of unknown size,
+	// allowing objects of up to 10000 parts.
+	partSize = 16 * 1024 * 1024
+)
+
+func init() {
+	storage.RegisterStorage(&S3{})
+}
+
+type S3 struct {
+	// transport overrides the HTTP transport, nil uses the default one
+	transport http.RoundTripper
+	client    *minio.Client
+	bucket    string
+	prefix    string
+	// immutableDays sets an object lock retention on uploads, the bucket must
+	// have object lock enabled.
+	immutableDays int
+	immutableMode minio.RetentionMode
+}
+
+func (s *S3) Name() string {
+	return "s3"
+}
+
+func (s *S3) Schemes() []string {
+	return []string{"s3"}
+}
+
+// ParseURL reads s3://bucket/prefix?region=eu-west-1&endpoint=https://minio:9000&path_style=true,
+// credentials come from the options or the environment.
+func (s *S3) ParseURL(u *url.URL) (storage.Options, error) {
+	pathStyle, err := storage.QueryBool(u, "path_style")
+	return storage.Options{
+		Bucket:    u.Host,
+		Prefix:    u.Path,
+		Region:    u.Query().Get("region"),
+		Endpoint:  u.Query().Get("endpoint"),
+		PathStyle: pathStyle,
+	}, err
+}
+
+func (s *S3) Init(c storage.Options) error {
+	if err := c.Check("s3", "api_key", "api_secret", "bucket", "prefix", "region", "endpoint", "path_style", "immutable_days", "immutable_mode"); err != nil {
+		return err
+	}
+	if len(c.Bucket) == 0 {
+		return errors.New("missing bucket for s3 storage")
+	}
+
+	immutableDays, immutableMode, err := c.Immutability()
+	if err != nil {
+		return err
+	}
+
+	endpoint, secure, err := parseEndpoint(c.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{},
+	})
+	if len(c.APIKey) > 0 {
+		creds = credentials.NewStaticV4(c.APIKey, c.APISecret, "")
+	}
+
+	lookup := minio.BucketLookupAuto
+	if c.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       secure,
+		Region:       c.Region,
+		BucketLookup: lookup,
+		Transport:    s.transport,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.client = client
+	s.bucket = c.Bucket
+	s.prefix = strings.Trim(c.Prefix, "/")
+	s.immutableDays = immutableDays
+	s.immutableMode = minio.Governance
+	if immutableMode == storage.ImmutableCompliance {
+		s.immutableMode = minio.Compliance
+	}
+
+	return nil
+}
+
+func (s *S3) Upload(name string, content io.Reader) (string, error) {
+	key := s.key(name)
+	_, err := s.client.PutObject(context.Background(), s.bucket, key, content, -1, s.putOptions())
+	if err != nil {
+		return "", s.wrapError(name, err)
+	}
+
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key), nil
+}
+
+func (s *S3) GetContent(name string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(context.Background(), s.bucket, s.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// GetObject is lazy, stat the object so a missing backup fails here
+	if _, err := object.Stat(); err != nil {
+		_ = object.Close()
+		return nil, s.wrapError(name, err)
+	}
+
+	return object, nil
+}
+
+func (s *S3) putOptions() minio.PutObjectOptions {
+	options := minio.PutObjectOptions{PartSize: partSize}
+	if s.immutableDays > 0 {
+		options.Mode = s.immutableMode
+		options.RetainUntilDate = storage.RetainUntil(time.Now(), s.immutableDays)
+	}
+	return options
+}
+
+func (s *S3) key(name string) string {
+	return path.Join(s.prefix, name)
+}
+
+func parseEndpoint(endpoint string) (string, bool, error) {
+	if len(endpoint) == 0 {
+		return defaultEndpoint, true, nil
+	}
+	if !strings.Contains(endpoint, "://") {
+		return endpoint, true, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false, err
+	}
+
+	return u.Host, u.Scheme != "http", nil
+}
+
+func (s *S3) List(prefix string) ([]storage.Object, error) {
+	root := ""
+	if len(s.prefix) > 0 {
+		root = s.prefix + "/"
+	}
+
+	objects := make([]storage.Object, 0)
+	for info := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{
+		Prefix:    root + prefix,
+		Recursive: true,
+	}) {
+		if info.Err != nil {
+			return nil, s.wrapError(prefix, info.Err)
+		}
+		objects = append(objects, storage.Object{
+			Name:    strings.TrimPrefix(info.Key, root),
+			Size:    info.Size,
+			ModTime: info.LastModified,
+		})
+	}
+
+	return objects, nil
+}
+
+func (s *S3) Delete(name string) error {
+	// removing a missing key succeeds, report it like the other storages
+	info, err := s.client.StatObject(context.Background(), s.bucket, s.key(name), minio.StatObjectOptions{})
+	if err != nil {
+		return s.wrapError(name, err)
+	}
+	// removing a locked key succeeds too, but only hides it behind a delete
+	// marker
+	if err := checkUnlocked(name, info, time.Now()); err != nil {
+		return err
+	}
+
+	err = s.client.RemoveObject(context.Background(), s.bucket, s.key(name), minio.RemoveObjectOptions{})
+	return s.wrapError(name, err)
+}
+
+// checkUnlocked fails while the object lock retention or legal hold of info
+// protects it at now.
+func checkUnlocked(name string, info minio.ObjectInfo, now time.Time) error {
+	if strings.EqualFold(info.Metadata.Get("X-Amz-Object-Lock-Legal-Hold"), "ON") {
+		return fmt.Errorf("%s is under legal hold: %w", name, storage.ErrImmutable)
+	}
+
+	until, err := time.Parse(time.RFC3339, info.Metadata.Get("X-Amz-Object-Lock-Retain-Until-Date"))
+	if err == nil && now.Before(until) {
+		return fmt.Errorf("%s until %s: %w", name, until.Format(time.RFC3339), storage.ErrImmutable)
+	}
+	return nil
+}
+
+func (s *S3) wrapError(name string, err error) error {
+	response := minio.ToErrorResponse(err)
+	if response.Code == "NoSuchKey" {
+		return fmt.Errorf("%s: %w", name, storage.ErrNotExist)
+	}
+	// a locked version, MinIO answers ObjectLocked and AWS AccessDenied
+	if response.Code == "ObjectLocked" || response.StatusCode == http.StatusForbidden && strings.Contains(strings.ToLower(response.Message), "object lock") {
+		return fmt.Errorf("%s: %w", name, storage.ErrImmutable)
+	}
+	// minio already retried these, a later attempt may still succeed
+	if response.StatusCode >= http.StatusInternalServerError || response.StatusCode == http.StatusTooManyRequests {
+		return storage.Retriable(err)
+	}
+	return err
+}
@@ -0,0 +1,131 @@
+package s3
+
+import (
+	"bytes"
+	"errors"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/minio/minio-go/v7"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"react-web-backup/storage"
+	"react-web-backup/storage/storagetest"
+	"testing"
+	"time"
+)
+
+func newTestS3(t *testing.T) *S3 {
+	backend := s3mem.New()
+	if err := backend.CreateBucket("backups"); err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	server := httptest.NewTLSServer(gofakes3.New(backend).Server())
+	t.Cleanup(server.Close)
+
+	s := &S3{transport: server.Client().Transport}
+	err := s.Init(storage.Options{
+		APIKey:    "key",
+		APISecret: "secret",
+		Bucket:    "backups",
+		Prefix:    "/nightly/",
+		Region:    "us-east-1",
+		Endpoint:  server.URL,
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+
+	return s
+}
+
+func TestS3(t *testing.T) {
+	storagetest.TestStorage(t, newTestS3(t), true)
+}
+
+func TestS3_UploadResumable(t *testing.T) {
+	s := newTestS3(t)
+
+	content := bytes.Repeat([]byte("INSERT INTO users (id) VALUES (1);\n"), partSize/16)
+	p := &storage.Progress{}
+
+	// the first run is interrupted once the first part is confirmed
+	_, err := s.UploadResumable("backup.sql", bytes.NewReader(content), int64(len(content)), p, func() error {
+		if len(p.Parts) == 1 {
+			return errors.New("interrupted")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected the upload to be interrupted")
+	}
+
+	uploaded := make([]int, 0)
+	filePath, err := s.UploadResumable("backup.sql", bytes.NewReader(content), int64(len(content)), p, func() error {
+		uploaded = append(uploaded, p.Parts[len(p.Parts)-1].Number)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if filePath != "s3://backups/nightly/backup.sql" {
+		t.Fatalf("unexpected path %s", filePath)
+	}
+	if len(uploaded) != 2 || uploaded[0] != 2 || uploaded[1] != 3 {
+		t.Fatalf("resumed upload sent parts %v", uploaded)
+	}
+
+	r, err := s.GetContent("backup.sql")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if !bytes.Equal(b, content) {
+		t.Fatal("resumed upload does not match the content")
+	}
+}
+
+func TestS3_Locked(t *testing.T) {
+	now := time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		metadata http.Header
+		locked   bool
+	}{
+		"unlocked":   {http.Header{}, false},
+		"retained":   {http.Header{"X-Amz-Object-Lock-Retain-Until-Date": {"2022-06-16T12:00:00Z"}}, true},
+		"expired":    {http.Header{"X-Amz-Object-Lock-Retain-Until-Date": {"2022-06-14T12:00:00Z"}}, false},
+		"legal hold": {http.Header{"X-Amz-Object-Lock-Legal-Hold": {"ON"}}, true},
+	}
+	for name, tt := range tests {
+		err := checkUnlocked("backup.sql", minio.ObjectInfo{Metadata: tt.metadata}, now)
+		if errors.Is(err, storage.ErrImmutable) != tt.locked {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+	}
+
+	s := &S3{}
+	responses := []minio.ErrorResponse{
+		{Code: "ObjectLocked", StatusCode: http.StatusBadRequest, Message: "Object is WORM protected and cannot be overwritten"},
+		{Code: "AccessDenied", StatusCode: http.StatusForbidden, Message: "Access Denied because object protected by object lock."},
+	}
+	for _, response := range responses {
+		if err := s.wrapError("backup.sql", response); !errors.Is(err, storage.ErrImmutable) {
+			t.Fatalf("%s: expected ErrImmutable, got %v", response.Code, err)
+		}
+	}
+	denied := minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden, Message: "Access Denied."}
+	if err := s.wrapError("backup.sql", denied); errors.Is(err, storage.ErrImmutable) {
+		t.Fatalf("a plain access denied is not immutable: %v", err)
+	}
+}
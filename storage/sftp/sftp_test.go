@@ -0,0 +1,186 @@
+package sftp
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"net"
+	"os"
+	"path"
+	"react-web-backup/storage"
+	"react-web-backup/storage/storagetest"
+	"strings"
+	"testing"
+)
+
+func TestSFTP(t *testing.T) {
+	addr, hostKey := startServer(t, "backup", "secret")
+
+	s := &SFTP{}
+	err := s.Init(storage.Options{
+		Host:               "127.0.0.1",
+		Port:               addr.Port,
+		User:               "backup",
+		Password:           "secret",
+		StoragePath:        path.Join(t.TempDir(), "backups"),
+		HostKeyFingerprint: ssh.FingerprintSHA256(hostKey),
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	storagetest.TestStorage(t, s, true)
+}
+
+func TestSFTP_WrongPassword(t *testing.T) {
+	addr, _ := startServer(t, "backup", "secret")
+
+	s := &SFTP{}
+	err := s.Init(storage.Options{
+		Host:               "127.0.0.1",
+		Port:               addr.Port,
+		User:               "backup",
+		Password:           "wrong",
+		InsecureSkipVerify: true,
+	})
+	if err == nil {
+		t.Fatal("expected authentication error")
+	}
+}
+
+func TestSFTP_HostKey(t *testing.T) {
+	addr, hostKey := startServer(t, "backup", "secret")
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	options := storage.Options{
+		Host:        "127.0.0.1",
+		Port:        addr.Port,
+		User:        "backup",
+		Password:    "secret",
+		StoragePath: path.Join(home, "backups"),
+	}
+
+	// without ~/.ssh/known_hosts the host key cannot be verified
+	if err := (&SFTP{}).Init(options); err == nil {
+		t.Fatal("expected missing known_hosts error")
+		return
+	}
+
+	_, otherKey := startServer(t, "backup", "secret")
+	wrong := options
+	wrong.HostKeyFingerprint = ssh.FingerprintSHA256(otherKey)
+	if err := (&SFTP{}).Init(wrong); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected host key mismatch, got %v", err)
+		return
+	}
+
+	if err := os.MkdirAll(path.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+		return
+	}
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr.String())}, hostKey)
+	if err := os.WriteFile(path.Join(home, ".ssh", "known_hosts"), []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+		return
+	}
+	if err := (&SFTP{}).Init(options); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	// a known_hosts file listing another key for the host is rejected
+	other := path.Join(home, "other_known_hosts")
+	line = knownhosts.Line([]string{knownhosts.Normalize(addr.String())}, otherKey)
+	if err := os.WriteFile(other, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+		return
+	}
+	options.KnownHosts = other
+	if err := (&SFTP{}).Init(options); err == nil {
+		t.Fatal("expected known_hosts mismatch")
+	}
+}
+
+// startServer runs an in-process SSH server exposing the sftp subsystem on
+// the local file system, it returns its address and host key.
+func startServer(t *testing.T, user, password string) (*net.TCPAddr, ssh.PublicKey) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == user && string(pass) == password {
+				return nil, nil
+			}
+			return nil, io.ErrUnexpectedEOF
+		},
+	}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(conn, config)
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr), signer.PublicKey()
+}
+
+func serveConn(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+
+				server, err := sftp.NewServer(channel)
+				if err != nil {
+					return
+				}
+				_ = server.Serve()
+				_ = channel.Close()
+			}
+		}()
+	}
+}
@@ -1,23 +1,99 @@
 package storage
 
-import "fmt"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotExist is wrapped by the errors of GetContent and Delete when the
+	// object is missing.
+	ErrNotExist = fs.ErrNotExist
+	// ErrExist is wrapped by the errors of Upload when the object exists and
+	// cannot be overwritten.
+	ErrExist = fs.ErrExist
+)
 
 type Options struct {
-	APIKey      string `yaml:"api_key,omitempty"`
-	APISecret   string `yaml:"api_secret,omitempty"`
-	StoragePath string `yaml:"storage_path,omitempty"`
+	APIKey             string `yaml:"api_key,omitempty"`
+	APISecret          string `yaml:"api_secret,omitempty"`
+	StoragePath        string `yaml:"storage_path,omitempty"`
+	Overwrite          bool   `yaml:"overwrite,omitempty"`
+	Bucket             string `yaml:"bucket,omitempty"`
+	Prefix             string `yaml:"prefix,omitempty"`
+	Region             string `yaml:"region,omitempty"`
+	Endpoint           string `yaml:"endpoint,omitempty"`
+	PathStyle          bool   `yaml:"path_style,omitempty"`
+	Host               string `yaml:"host,omitempty"`
+	Port               int    `yaml:"port,omitempty"`
+	User               string `yaml:"user,omitempty"`
+	Password           string `yaml:"password,omitempty"`
+	IdentifyKeyPath    string `yaml:"identify_key_path,omitempty"`
+	KnownHosts         string `yaml:"known_hosts,omitempty"`
+	HostKeyFingerprint string `yaml:"host_key_fingerprint,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+	CAFile             string `yaml:"ca_file,omitempty"`
+	TLS                string `yaml:"tls,omitempty"`
+	Credentials        string `yaml:"credentials,omitempty"`
+	CredentialsFile    string `yaml:"credentials_file,omitempty"`
+	Account            string `yaml:"account,omitempty"`
+	AccountKey         string `yaml:"account_key,omitempty"`
+	SASToken           string `yaml:"sas_token,omitempty"`
+	Container          string `yaml:"container,omitempty"`
+	// ImmutableDays protects every upload against overwrite and deletion for
+	// that many days, in ImmutableMode where the storage supports modes.
+	ImmutableDays int    `yaml:"immutable_days,omitempty"`
+	ImmutableMode string `yaml:"immutable_mode,omitempty"`
+}
+
+// Check fails when o sets options other than supported, named as in the yaml
+// config, so that an option of another client is not silently ignored.
+func (o Options) Check(client string, supported ...string) error {
+	v := reflect.ValueOf(o)
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		if !v.Field(i).IsZero() && !slices.Contains(supported, name) {
+			return fmt.Errorf("option %s is not supported by %s storage", name, client)
+		}
+	}
+	return nil
 }
 
 type StorageConfig struct {
 	Client  string  `yaml:"client"`
 	Options Options `yaml:"options"`
+	// URL sets the client and options at once, e.g. file:///var/backups.
+	URL string `yaml:"url,omitempty"`
+	// Repository keeps the backups deduplicated, see package repository.
+	Repository bool         `yaml:"repository,omitempty"`
+	Retry      *RetryConfig `yaml:"retry,omitempty"`
+	// RateLimit bounds the bytes per second transferred, zero is unlimited.
+	RateLimit int64 `yaml:"rate_limit,omitempty"`
+}
+
+// Object describes a backup kept in a storage.
+type Object struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
 }
 
 type Storage interface {
 	Name() string
 	Init(options Options) error
-	Upload(name string, fileContent string) (string, error)
-	GetContent(name string) (string, error)
+	Upload(name string, content io.Reader) (string, error)
+	GetContent(name string) (io.ReadCloser, error)
+	// List returns the objects whose name starts with prefix, sorted by name.
+	List(prefix string) ([]Object, error)
+	Delete(name string) error
 }
 
 var storages = make(map[string]Storage)
@@ -32,11 +108,61 @@ func RegisterStorage(s Storage) {
 	storages[s.Name()] = s
 }
 
+// GetStorage returns a new storage of the registered client type initialised
+// with the config options, throttled and retrying as configured.
 func GetStorage(o *StorageConfig) (Storage, error) {
-	if s, ok := storages[o.Client]; ok {
-		err := s.Init(o.Options)
-		return s, err
+	client, options := o.Client, o.Options
+	if len(o.URL) > 0 {
+		var err error
+		if client, options, err = resolveURL(o); err != nil {
+			return nil, err
+		}
+	}
+
+	if s, ok := storages[client]; ok {
+		// several configs may use the same client, never share the registered value
+		s = reflect.New(reflect.TypeOf(s).Elem()).Interface().(Storage)
+		if err := s.Init(options); err != nil {
+			return s, err
+		}
+
+		if o.RateLimit > 0 {
+			s = newThrottled(s, o.RateLimit)
+		}
+		if o.Retry != nil {
+			s = newRetrying(s, *o.Retry)
+		}
+		return s, nil
 	}
 
-	return nil, fmt.Errorf("cannot find storage for %s type", o.Client)
+	return nil, fmt.Errorf("cannot find storage for %s type", client)
+}
+
+// Key identifies the location o stores to, whatever the order of the configs
+// or whether it is set by URL, so that state about it outlives config
+// changes. Credentials are left out.
+func (o *StorageConfig) Key() (string, error) {
+	client, options := o.Client, o.Options
+	if len(o.URL) > 0 {
+		var err error
+		if client, options, err = resolveURL(o); err != nil {
+			return "", err
+		}
+	}
+
+	location := []string{
+		client,
+		options.Endpoint,
+		options.Host,
+		strconv.Itoa(options.Port),
+		options.User,
+		options.Account,
+		options.Bucket,
+		options.Container,
+		options.StoragePath,
+		options.Prefix,
+		strconv.FormatBool(o.Repository),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(location, "\n")))
+	return hex.EncodeToString(sum[:8]), nil
 }
@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestOptions_Check(t *testing.T) {
+	supported := []string{"bucket", "prefix", "immutable_days"}
+	if err := (Options{Bucket: "backups", ImmutableDays: 7}).Check("s3", supported...); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	err := (Options{Bucket: "backups", StoragePath: "/var/backups"}).Check("s3", supported...)
+	if err == nil || err.Error() != "option storage_path is not supported by s3 storage" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Package storagetest checks that storage backends behave alike.
+package storagetest
+
+import (
+	"errors"
+	"io"
+	"react-web-backup/storage"
+	"strings"
+	"testing"
+)
+
+// TestStorage runs the operations of storage.Storage against s, which must be
+// initialised and empty. overwrite tells whether s replaces existing objects
+// on Upload, else Upload must fail with storage.ErrExist.
+func TestStorage(t *testing.T, s storage.Storage, overwrite bool) {
+	t.Helper()
+
+	objects := map[string]string{
+		"backup.sql":       "SELECT 1;",
+		"backup.sql.gz":    "SELECT 22;",
+		"chunks/ab/abcdef": "chunk",
+	}
+	for name, content := range objects {
+		filePath, err := s.Upload(name, strings.NewReader(content))
+		if err != nil {
+			t.Fatalf("upload %s: %v", name, err)
+			return
+		}
+		if !strings.HasSuffix(filePath, name) {
+			t.Fatalf("upload %s returned the path %s", name, filePath)
+		}
+	}
+	for name, content := range objects {
+		checkContent(t, s, name, content)
+	}
+
+	listed, err := s.List("")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	checkObjects(t, listed, "backup.sql", "backup.sql.gz", "chunks/ab/abcdef")
+	for _, o := range listed {
+		if o.Size != int64(len(objects[o.Name])) || o.ModTime.IsZero() {
+			t.Fatalf("unexpected object %+v", o)
+		}
+	}
+
+	listed, err = s.List("backup")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	checkObjects(t, listed, "backup.sql", "backup.sql.gz")
+
+	listed, err = s.List("chunks/")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	checkObjects(t, listed, "chunks/ab/abcdef")
+
+	_, err = s.Upload("backup.sql", strings.NewReader("SELECT 2;"))
+	switch {
+	case overwrite && err != nil:
+		t.Fatalf("overwrite backup.sql: %v", err)
+		return
+	case overwrite:
+		checkContent(t, s, "backup.sql", "SELECT 2;")
+	case !errors.Is(err, storage.ErrExist):
+		t.Fatalf("expected ErrExist on overwrite, got %v", err)
+		return
+	default:
+		checkContent(t, s, "backup.sql", "SELECT 1;")
+	}
+
+	if content, err := s.GetContent("missing.sql"); !errors.Is(err, storage.ErrNotExist) {
+		if err == nil {
+			_ = content.Close()
+		}
+		t.Fatalf("expected ErrNotExist reading a missing object, got %v", err)
+		return
+	}
+	if err := s.Delete("missing.sql"); !errors.Is(err, storage.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist deleting a missing object, got %v", err)
+		return
+	}
+
+	for name := range objects {
+		if err := s.Delete(name); err != nil {
+			t.Fatalf("delete %s: %v", name, err)
+			return
+		}
+	}
+	if _, err := s.GetContent("backup.sql"); !errors.Is(err, storage.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist after delete, got %v", err)
+		return
+	}
+	listed, err = s.List("")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	checkObjects(t, listed)
+}
+
+func checkContent(t *testing.T, s storage.Storage, name string, expected string) {
+	t.Helper()
+
+	content, err := s.GetContent(name)
+	if err != nil {
+		t.Fatalf("get %s: %v", name, err)
+		return
+	}
+	b, err := io.ReadAll(content)
+	_ = content.Close()
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+		return
+	}
+	if string(b) != expected {
+		t.Fatalf("unexpected content %q for %s", b, name)
+	}
+}
+
+// checkObjects fails unless objects are exactly the names, in that order.
+func checkObjects(t *testing.T, objects []storage.Object, names ...string) {
+	t.Helper()
+
+	listed := make([]string, 0)
+	for _, o := range objects {
+		listed = append(listed, o.Name)
+	}
+	if strings.Join(listed, ",") != strings.Join(names, ",") {
+		t.Fatalf("listed %q, want %q", listed, names)
+	}
+}
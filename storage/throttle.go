@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"golang.org/x/time/rate"
+	"io"
+)
+
+// maxBurst bounds the bytes transferred at once by a throttled storage.
+const maxBurst = 256 * 1024
+
+// throttled limits the bytes per second a storage uploads and downloads, both
+// directions share the limit.
+type throttled struct {
+	Storage
+	limiter *rate.Limiter
+}
+
+func newThrottled(s Storage, bytesPerSecond int64) *throttled {
+	burst := int(min(bytesPerSecond, maxBurst))
+	return &throttled{Storage: s, limiter: rate.NewLimiter(rate.Limit(bytesPerSecond), burst)}
+}
+
+func (t *throttled) Upload(name string, content io.Reader) (string, error) {
+	return t.Storage.Upload(name, &throttledReader{r: content, limiter: t.limiter})
+}
+
+func (t *throttled) UploadResumable(name string, content io.ReaderAt, size int64, progress *Progress, save func() error) (string, error) {
+	return uploadResumable(t.Storage, name, &throttledReaderAt{r: content, limiter: t.limiter}, size, progress, save)
+}
+
+func (t *throttled) GetContent(name string) (io.ReadCloser, error) {
+	content, err := t.Storage.GetContent(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{&throttledReader{r: content, limiter: t.limiter}, content}, nil
+}
+
+type throttledReader struct {
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.limiter.Burst() {
+		p = p[:t.limiter.Burst()]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if waitErr := t.limiter.WaitN(context.Background(), n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+type throttledReaderAt struct {
+	r       io.ReaderAt
+	limiter *rate.Limiter
+}
+
+func (t *throttledReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		size := min(len(p)-read, t.limiter.Burst())
+		if err := t.limiter.WaitN(context.Background(), size); err != nil {
+			return read, err
+		}
+		n, err := t.r.ReadAt(p[read:read+size], off+int64(read))
+		read += n
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
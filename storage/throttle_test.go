@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestThrottled(t *testing.T) {
+	s := &memStorage{}
+	th := newThrottled(s, 64*1024)
+
+	start := time.Now()
+	if _, err := th.Upload("backup.sql", bytes.NewReader(make([]byte, 192*1024))); err != nil {
+		t.Fatal(err)
+		return
+	}
+	// the first 64 KiB are the burst
+	if elapsed := time.Since(start); elapsed < 1900*time.Millisecond {
+		t.Fatalf("upload took %s", elapsed)
+	}
+	if s.content.Len() != 192*1024 {
+		t.Fatalf("uploaded %d bytes", s.content.Len())
+	}
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+)
+
+// URLParser is implemented by the storages which can be configured with a
+// URL, such as s3://bucket/prefix?region=eu-west-1.
+type URLParser interface {
+	// Schemes returns the URL schemes handled by the storage.
+	Schemes() []string
+	// ParseURL returns the options set by u.
+	ParseURL(u *url.URL) (Options, error)
+}
+
+// UnmarshalYAML accepts a storage URL in place of the client and options.
+func (c *StorageConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var u string
+	if err := unmarshal(&u); err == nil {
+		*c = StorageConfig{URL: u}
+		return nil
+	}
+
+	type plain StorageConfig
+	return unmarshal((*plain)(c))
+}
+
+// resolveURL returns the client and options of the config URL, options set by
+// the URL take precedence over the ones of the config.
+func resolveURL(o *StorageConfig) (string, Options, error) {
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return "", Options{}, err
+	}
+
+	for client, s := range storages {
+		parser, ok := s.(URLParser)
+		if !ok || !slices.Contains(parser.Schemes(), u.Scheme) {
+			continue
+		}
+
+		options, err := parser.ParseURL(u)
+		if err != nil {
+			return "", Options{}, fmt.Errorf("invalid %s storage url: %w", client, err)
+		}
+		return client, mergeOptions(o.Options, options), nil
+	}
+
+	return "", Options{}, fmt.Errorf("cannot find storage for %s urls", u.Scheme)
+}
+
+func mergeOptions(base Options, override Options) Options {
+	b := reflect.ValueOf(&base).Elem()
+	o := reflect.ValueOf(override)
+	for i := 0; i < o.NumField(); i++ {
+		if !o.Field(i).IsZero() {
+			b.Field(i).Set(o.Field(i))
+		}
+	}
+	return base
+}
+
+// URLUser sets the user and password of u on options.
+func URLUser(u *url.URL, options *Options) {
+	if u.User == nil {
+		return
+	}
+	options.User = u.User.Username()
+	options.Password, _ = u.User.Password()
+}
+
+// URLPort returns the port of u, zero when it has none.
+func URLPort(u *url.URL) (int, error) {
+	if len(u.Port()) == 0 {
+		return 0, nil
+	}
+	return strconv.Atoi(u.Port())
+}
+
+// QueryBool returns the boolean query parameter key of u, false when unset.
+func QueryBool(u *url.URL, key string) (bool, error) {
+	value := u.Query().Get(key)
+	if len(value) == 0 {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
@@ -0,0 +1,103 @@
+package webdav
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// digest implements the client side of the HTTP digest authentication
+// (RFC 2617) with the MD5 algorithm.
+type digest struct {
+	realm  string
+	nonce  string
+	opaque string
+	qop    string
+	nc     uint32
+}
+
+func newDigest(challenge string) (*digest, error) {
+	params := parseChallenge(strings.TrimSpace(challenge[len("digest "):]))
+
+	if algorithm := params["algorithm"]; len(algorithm) > 0 && !strings.EqualFold(algorithm, "MD5") {
+		return nil, fmt.Errorf("unsupported digest algorithm %s", algorithm)
+	}
+
+	d := &digest{
+		realm:  params["realm"],
+		nonce:  params["nonce"],
+		opaque: params["opaque"],
+	}
+	for _, qop := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(qop) == "auth" {
+			d.qop = "auth"
+		}
+	}
+
+	return d, nil
+}
+
+func (d *digest) authorize(method string, uri string, user string, password string) string {
+	ha1 := md5Hex(fmt.Sprintf("%s:%s:%s", user, d.realm, password))
+	ha2 := md5Hex(fmt.Sprintf("%s:%s", method, uri))
+
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=MD5`, user, d.realm, d.nonce, uri)
+	if len(d.qop) > 0 {
+		nc := fmt.Sprintf("%08x", atomic.AddUint32(&d.nc, 1))
+		cnonce := cnonce()
+		response := md5Hex(fmt.Sprintf("%s:%s:%s:%s:%s:%s", ha1, d.nonce, nc, cnonce, d.qop, ha2))
+		header += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s", response="%s"`, d.qop, nc, cnonce, response)
+	} else {
+		header += fmt.Sprintf(`, response="%s"`, md5Hex(fmt.Sprintf("%s:%s:%s", ha1, d.nonce, ha2)))
+	}
+	if len(d.opaque) > 0 {
+		header += fmt.Sprintf(`, opaque="%s"`, d.opaque)
+	}
+
+	return header
+}
+
+// parseChallenge parses the comma separated key=value pairs of a challenge,
+// quoted values may contain commas.
+func parseChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for len(s) > 0 {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimSpace(rest)
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			rest = "," + rest
+		}
+		params[key] = strings.TrimSpace(value)
+
+		_, s, _ = strings.Cut(rest, ",")
+	}
+	return params
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func cnonce() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,165 @@
+package webdav
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"golang.org/x/net/webdav"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"react-web-backup/storage"
+	"react-web-backup/storage/storagetest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWebDAV(t *testing.T) {
+	handler := &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	tests := map[string]http.Handler{
+		"basic":  basicAuth(handler, "backup", "secret"),
+		"digest": digestAuth(handler, "backup", "secret", func() string { return "dcd98b7102dd2f0e8b11d0f600bfb0c093" }),
+	}
+
+	for name, h := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewTLSServer(h)
+			defer server.Close()
+
+			caFile := path.Join(t.TempDir(), "ca.pem")
+			ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+			if err := os.WriteFile(caFile, ca, 0600); err != nil {
+				t.Fatal(err)
+				return
+			}
+
+			w := &WebDAV{}
+			err := w.Init(storage.Options{
+				Endpoint:    server.URL + "/dav",
+				StoragePath: name + "/nightly",
+				User:        "backup",
+				Password:    "secret",
+				CAFile:      caFile,
+			})
+			if err != nil {
+				t.Fatal(err)
+				return
+			}
+
+			storagetest.TestStorage(t, w, true)
+
+			w.password = "wrong"
+			if _, err := w.List(""); err == nil {
+				t.Fatal("expected authentication error")
+			}
+		})
+	}
+}
+
+func basicAuth(h http.Handler, user string, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || u != user || p != password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="backup"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// digestAuth challenges for digest authentication with the current nonce,
+// an outdated nonce is answered with stale=true.
+func digestAuth(h http.Handler, user string, password string, nonce func() string) http.Handler {
+	const realm = "backup"
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		params := parseChallenge(strings.TrimPrefix(header, "Digest "))
+
+		sum := func(s string) string {
+			b := md5.Sum([]byte(s))
+			return hex.EncodeToString(b[:])
+		}
+		ha1 := sum(fmt.Sprintf("%s:%s:%s", user, realm, password))
+		ha2 := sum(fmt.Sprintf("%s:%s", r.Method, params["uri"]))
+		expected := sum(fmt.Sprintf("%s:%s:%s:%s:%s:%s", ha1, params["nonce"], params["nc"], params["cnonce"], params["qop"], ha2))
+
+		if !strings.HasPrefix(header, "Digest ") || params["username"] != user || params["uri"] != r.URL.RequestURI() || params["response"] != expected || params["nonce"] != nonce() {
+			stale := ""
+			if params["response"] == expected {
+				stale = ", stale=true"
+			}
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", qop="auth,auth-int", nonce="%s", opaque="5ccc069c403ebaf9f0171e9517f40e41"%s`, realm, nonce(), stale))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func TestWebDAV_StaleNonce(t *testing.T) {
+	var nonce atomic.Int64
+	handler := &webdav.Handler{
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+	server := httptest.NewServer(digestAuth(handler, "backup", "secret", func() string {
+		return fmt.Sprintf("nonce%d", nonce.Load())
+	}))
+	defer server.Close()
+
+	w := &WebDAV{}
+	err := w.Init(storage.Options{
+		Endpoint: server.URL,
+		User:     "backup",
+		Password: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	// the dump is streamed, the nonce expires meanwhile
+	if _, err := w.Upload("backup.sql", io.MultiReader(strings.NewReader("SELECT 1;"))); err != nil {
+		t.Fatal(err)
+		return
+	}
+	nonce.Add(1)
+
+	// the manifest upload and the prune of the same run use the new nonce
+	if _, err := w.Upload("backup.sql.manifest.json", bytes.NewReader([]byte("{}"))); err != nil {
+		t.Fatal(err)
+		return
+	}
+	nonce.Add(1)
+	if err := w.Delete("backup.sql"); err != nil {
+		t.Fatal(err)
+		return
+	}
+	nonce.Add(1)
+	objects, err := w.List("")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if len(objects) != 1 || objects[0].Name != "backup.sql.manifest.json" {
+		t.Fatalf("unexpected objects %+v", objects)
+	}
+
+	// a streamed upload cannot be replayed and fails on an expired nonce
+	nonce.Add(1)
+	if _, err := w.Upload("other.sql", io.MultiReader(strings.NewReader("SELECT 1;"))); err == nil {
+		t.Fatal("expected the streamed upload to fail")
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 	"io"
 	"net"
 	"os"
 	"os/signal"
 	"path"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -23,7 +25,12 @@ type Tunnel struct {
 	User            string `yaml:"user,omitempty"`
 	Password        string `yaml:"password,omitempty"`
 	IdentifyKeyPath string `yaml:"identify_key_path,omitempty"`
-	keepAlive       struct {
+	// KnownHosts is a known_hosts file and HostKeyFingerprint a SHA256
+	// fingerprint as printed by ssh-keygen -l, the host key is not checked
+	// when both are empty.
+	KnownHosts         string `yaml:"known_hosts,omitempty"`
+	HostKeyFingerprint string `yaml:"host_key_fingerprint,omitempty"`
+	keepAlive          struct {
 		Interval int
 		CountMax int
 	}
@@ -84,11 +91,86 @@ func (tc *Tunnel) GetDialAddr() string {
 	return fmt.Sprintf("localhost:%d", tc.GetBindPort())
 }
 
+func (tc *Tunnel) GetAddr() string {
+	return fmt.Sprintf("%s:%d", tc.GetHost(), tc.GetPort())
+}
+
 func (tc *Tunnel) String() string {
 	left, mode, right := tc.GetBindAddr(), "->", tc.GetDialAddr()
 	return fmt.Sprintf("%s@%s | %s %s %s", tc.GetUser(), tc.GetHost(), left, mode, right)
 }
 
+// AuthMethods returns the SSH authentication for the tunnel, preferring the
+// password over the identify key when both are set.
+func (tc *Tunnel) AuthMethods() ([]ssh.AuthMethod, error) {
+	auth := make([]ssh.AuthMethod, 0)
+
+	if len(tc.GetPassword()) > 0 {
+		auth = append(auth, ssh.Password(tc.GetPassword()))
+	} else if len(tc.GetIdentifyKeyPath()) > 0 {
+		key, err := os.ReadFile(tc.GetIdentifyKeyPath())
+		if err != nil {
+			return nil, fmt.Errorf("cannot read identify key from %s: %w", tc.GetIdentifyKeyPath(), err)
+		}
+		signed, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signed))
+	}
+
+	return auth, nil
+}
+
+// HostKeyCallback verifies the host key against the fingerprint, else the
+// known_hosts file of the tunnel.
+func (tc *Tunnel) HostKeyCallback() (ssh.HostKeyCallback, error) {
+	if len(tc.HostKeyFingerprint) > 0 {
+		expected := "SHA256:" + strings.TrimPrefix(tc.HostKeyFingerprint, "SHA256:")
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if fingerprint := ssh.FingerprintSHA256(key); fingerprint != expected {
+				return fmt.Errorf("host key %s of %s does not match %s", fingerprint, hostname, expected)
+			}
+			return nil
+		}, nil
+	}
+	if len(tc.KnownHosts) > 0 {
+		return knownhosts.New(tc.KnownHosts)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return nil
+	}, nil
+}
+
+func (tc *Tunnel) ClientConfig() (*ssh.ClientConfig, error) {
+	auth, err := tc.AuthMethods()
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := tc.HostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            tc.GetUser(),
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         5 * time.Second,
+	}, nil
+}
+
+// Dial opens an SSH connection to the tunnel host.
+func (tc *Tunnel) Dial() (*ssh.Client, error) {
+	config, err := tc.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.Dial("tcp", tc.GetAddr(), config)
+}
+
 func (tc *Tunnel) Start() {
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
@@ -111,37 +193,8 @@ func (tc *Tunnel) bindTunnel(ctx context.Context, wg *sync.WaitGroup) {
 	for {
 		var once sync.Once // Only print errors once per session
 		func() {
-			auth := make([]ssh.AuthMethod, 0)
-
-			if len(tc.GetPassword()) > 0 {
-				auth = append(auth, ssh.Password(tc.GetPassword()))
-			} else if len(tc.GetIdentifyKeyPath()) > 0 {
-				key, err := os.ReadFile(tc.GetIdentifyKeyPath())
-				if err != nil {
-					once.Do(func() {
-						fmt.Printf("Cannot read identify key from %s\n", tc.GetIdentifyKeyPath())
-					})
-					return
-				}
-				signed, err := ssh.ParsePrivateKey(key)
-				if err != nil {
-					once.Do(func() {
-						fmt.Printf(err.Error())
-					})
-					return
-				}
-				auth = append(auth, ssh.PublicKeys(signed))
-			}
-
 			// Connect to the server host via SSH.
-			cl, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", tc.GetHost(), tc.GetPort()), &ssh.ClientConfig{
-				User: tc.GetUser(),
-				Auth: auth,
-				HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-					return nil
-				},
-				Timeout: 5 * time.Second,
-			})
+			cl, err := tc.Dial()
 			if err != nil {
 				once.Do(func() { fmt.Printf("(%v) SSH dial error: %v\n", tc, err) })
 				return
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// maxStatementSize bounds a single SQL statement read by NewStatementScanner.
+const maxStatementSize = 256 * 1024 * 1024
+
+// NewStatementScanner returns a scanner which yields the SQL statements of r
+// one at a time, so that a dump can be replayed without holding it in memory.
+func NewStatementScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStatementSize)
+	scanner.Split(ScanStatements)
+	return scanner
+}
+
+// ScanStatements is a bufio.SplitFunc splitting SQL text on semicolons which
+// are not part of a quoted identifier, string literal, dollar-quoted body or
+// comment. Returned tokens are trimmed and empty statements are skipped.
+func ScanStatements(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	start := 0
+	for start < len(data) && isSpace(data[start]) {
+		start++
+	}
+
+	for i := start; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == ';':
+			if statement := bytes.TrimSpace(data[start:i]); len(statement) > 0 {
+				return i + 1, statement, nil
+			}
+			return i + 1, nil, nil
+		case c == '\'' || c == '"' || c == '`':
+			end := bytes.IndexByte(data[i+1:], c)
+			if end < 0 {
+				return needMore(data, start, atEOF)
+			}
+			i += end + 1
+		case c == '-' && i+1 < len(data) && data[i+1] == '-':
+			end := bytes.IndexByte(data[i:], '\n')
+			if end < 0 {
+				return needMore(data, start, atEOF)
+			}
+			i += end
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return needMore(data, start, atEOF)
+			}
+			i += end + 3
+		case c == '$' && (i == start || !isIdentifier(data[i-1])):
+			tag, complete := dollarTag(data[i:])
+			if !complete && !atEOF {
+				return 0, nil, nil
+			}
+			if tag == "" {
+				continue
+			}
+			end := bytes.Index(data[i+len(tag):], []byte(tag))
+			if end < 0 {
+				return needMore(data, start, atEOF)
+			}
+			i += len(tag) + end + len(tag) - 1
+		case (c == '-' || c == '/') && i+1 == len(data) && !atEOF:
+			return 0, nil, nil
+		}
+	}
+
+	return needMore(data, start, atEOF)
+}
+
+func needMore(data []byte, start int, atEOF bool) (int, []byte, error) {
+	if !atEOF {
+		return 0, nil, nil
+	}
+	if statement := bytes.TrimSpace(data[start:]); len(statement) > 0 {
+		return len(data), statement, nil
+	}
+	return len(data), nil, nil
+}
+
+// dollarTag returns the opening $tag$ of a dollar-quoted string at the start
+// of data, or an empty string when data does not start with one. complete is
+// false when data ends before the tag could be told apart.
+func dollarTag(data []byte) (tag string, complete bool) {
+	for i := 1; i < len(data); i++ {
+		c := data[i]
+		if c == '$' {
+			return string(data[:i+1]), true
+		}
+		if !isIdentifier(c) || i == 1 && c >= '0' && c <= '9' {
+			return "", true
+		}
+	}
+	return "", false
+}
+
+func isIdentifier(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return strings.IndexByte(" \t\r\n", c) >= 0
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewStatementScanner(t *testing.T) {
+	input := `CREATE TABLE a (id int);
+
+INSERT INTO a (id, name) VALUES (1,'x;y');
+-- comment; with semicolon
+INSERT INTO "b;c" (v) VALUES ('it''s');;
+/* block; comment */ SELECT 1;
+CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql;
+SELECT $1, $$a;b$$
+`
+	expected := []string{
+		"CREATE TABLE a (id int)",
+		"INSERT INTO a (id, name) VALUES (1,'x;y')",
+		"-- comment; with semicolon\nINSERT INTO \"b;c\" (v) VALUES ('it''s')",
+		"/* block; comment */ SELECT 1",
+		"CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql",
+		"SELECT $1, $$a;b$$",
+	}
+
+	// a tiny reader forces statements to straddle buffer refills
+	scanner := NewStatementScanner(&oneByteReader{r: strings.NewReader(input)})
+	statements := make([]string, 0)
+	for scanner.Scan() {
+		statements = append(statements, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(statements, expected) {
+		t.Fatalf("unexpected statements: %q", statements)
+	}
+}
+
+type oneByteReader struct {
+	r *strings.Reader
+}
+
+func (o *oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return o.r.Read(p[:1])
+}